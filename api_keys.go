@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxAPIKeyNameLength = 100
+
+var errInvalidAPIKey = errors.New("invalid api key")
+
+// apiKeyJson describes a personal API key. The key itself is only returned
+// once, when it is created.
+type apiKeyJson struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+type createdAPIKeyJson struct {
+	apiKeyJson
+	Key string `json:"key"`
+}
+
+func newAPIKeyJson(key database.ApiKey) apiKeyJson {
+	response := apiKeyJson{
+		ID:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.KeyPrefix,
+		Scopes:    auth.SplitScopes(key.Scopes),
+		CreatedAt: key.CreatedAt,
+	}
+	if key.ExpiresAt.Valid {
+		response.ExpiresAt = &key.ExpiresAt.Time
+	}
+	if key.LastUsedAt.Valid {
+		response.LastUsedAt = &key.LastUsedAt.Time
+	}
+	return response
+}
+
+func (cfg *apiConfig) handlerCreateAPIKey(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	type requestParams struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := requestParams{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "Couldn't decode parameters",
+		})
+		return
+	}
+
+	if params.Name == "" || len(params.Name) > maxAPIKeyNameLength {
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "name must be between 1 and 100 characters",
+		})
+		return
+	}
+
+	// Keys can't grant more than the credential used to create them. A key
+	// able to change the password or mint more keys has to ask for the
+	// account scope by name.
+	scopes := slices.DeleteFunc(slices.Clone(claims.Scopes), func(scope string) bool {
+		return scope == auth.ScopeAccount
+	})
+	if params.Scopes != nil {
+		for _, scope := range params.Scopes {
+			if !claims.HasScope(scope) {
+				respondWithJson(w, http.StatusBadRequest, errorResponse{
+					Error: "Unknown or unavailable scope: " + scope,
+				})
+				return
+			}
+		}
+		scopes = slices.Compact(slices.Sorted(slices.Values(params.Scopes)))
+	}
+
+	expiresAt := sql.NullTime{}
+	if params.ExpiresAt != nil {
+		if !params.ExpiresAt.After(time.Now()) {
+			respondWithJson(w, http.StatusBadRequest, errorResponse{
+				Error: "expires_at must be in the future",
+			})
+			return
+		}
+		expiresAt = sql.NullTime{Time: params.ExpiresAt.UTC(), Valid: true}
+	}
+
+	key, err := auth.MakeAPIKey()
+	if err != nil {
+		log.Printf("Failed to generate api key: %v", err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	apiKey, err := cfg.db.CreateAPIKey(r.Context(), database.CreateAPIKeyParams{
+		ExpiresAt: expiresAt,
+		Name:      params.Name,
+		KeyPrefix: key[:len(auth.APIKeyPrefix)+8],
+		KeyHash:   auth.HashToken(key),
+		Scopes:    auth.JoinScopes(scopes),
+		UserID:    claims.UserID,
+	})
+	if err != nil {
+		log.Printf("Failed to create api key for user %s: %v", claims.UserID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	log.Printf("API key %s created for user %s", apiKey.ID, claims.UserID)
+	respondWithJson(w, http.StatusCreated, createdAPIKeyJson{
+		apiKeyJson: newAPIKeyJson(apiKey),
+		Key:        key,
+	})
+}
+
+func (cfg *apiConfig) handlerListAPIKeys(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	keys, err := cfg.db.ListAPIKeys(r.Context(), claims.UserID)
+	if err != nil {
+		log.Printf("Failed to list api keys for user %s: %v", claims.UserID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	response := []apiKeyJson{}
+	for _, key := range keys {
+		response = append(response, newAPIKeyJson(key))
+	}
+	respondWithJson(w, http.StatusOK, response)
+}
+
+func (cfg *apiConfig) handlerRevokeAPIKey(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	keyID, err := uuid.Parse(r.PathValue("keyID"))
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Invalid api key id provided",
+		})
+		return
+	}
+
+	rows, err := cfg.db.RevokeAPIKey(r.Context(), database.RevokeAPIKeyParams{
+		ID:     keyID,
+		UserID: claims.UserID,
+	})
+	if err != nil {
+		log.Printf("Failed to revoke api key %s: %v", keyID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	if rows == 0 {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "API key does not exist",
+		})
+		return
+	}
+
+	log.Printf("API key %s revoked by user %s", keyID, claims.UserID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authenticateAPIKey resolves a personal API key to the claims of its owner.
+// A key only grants scopes its owner's current role still has.
+func (cfg *apiConfig) authenticateAPIKey(ctx context.Context, key string) (auth.AccessClaims, error) {
+	apiKey, err := cfg.db.GetAPIKeyByHash(ctx, auth.HashToken(key))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to look up api key: %v", err)
+		}
+		return auth.AccessClaims{}, errInvalidAPIKey
+	}
+	if apiKey.RevokedAt.Valid {
+		return auth.AccessClaims{}, errInvalidAPIKey
+	}
+	if apiKey.ExpiresAt.Valid && !apiKey.ExpiresAt.Time.After(time.Now().UTC()) {
+		return auth.AccessClaims{}, errInvalidAPIKey
+	}
+
+	if err := cfg.db.TouchAPIKey(ctx, apiKey.ID); err != nil {
+		log.Printf("Failed to record use of api key %s: %v", apiKey.ID, err)
+	}
+
+	role := auth.Role(apiKey.Role)
+	roleScopes := role.Scopes()
+	claims := auth.AccessClaims{
+		UserID:   apiKey.UserID,
+		IssuedAt: apiKey.CreatedAt,
+		Role:     role,
+		Scopes:   []string{},
+	}
+	if apiKey.ExpiresAt.Valid {
+		claims.ExpiresAt = apiKey.ExpiresAt.Time
+	}
+	for _, scope := range auth.SplitScopes(apiKey.Scopes) {
+		if slices.Contains(roleScopes, scope) {
+			claims.Scopes = append(claims.Scopes, scope)
+		}
+	}
+	return claims, nil
+}
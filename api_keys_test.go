@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+var apiKeyColumns = []string{
+	"id", "created_at", "expires_at", "revoked_at", "last_used_at",
+	"name", "key_prefix", "key_hash", "scopes", "user_id",
+}
+
+func TestCreateAPIKeyScopes(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantScopes string
+	}{
+		{
+			name:       "Default scopes leave out account",
+			body:       `{"name":"ci"}`,
+			wantScopes: "chirps:read chirps:write users:read users:write",
+		},
+		{
+			name:       "Account is granted when asked for",
+			body:       `{"name":"ci","scopes":["account","chirps:read"]}`,
+			wantScopes: "account chirps:read",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, mock := newMockConfig(t)
+			userID := uuid.New()
+			mock.ExpectQuery(queryName("CreateAPIKey")).
+				WithArgs(nil, "ci", sqlmock.AnyArg(), sqlmock.AnyArg(), test.wantScopes, userID.String()).
+				WillReturnRows(sqlmock.NewRows(apiKeyColumns).AddRow(
+					uuid.NewString(), time.Now(), nil, nil, nil,
+					"ci", "chirpy_12345678", "hash", test.wantScopes, userID.String(),
+				))
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/keys", strings.NewReader(test.body))
+			cfg.handlerCreateAPIKey(rec, req, auth.AccessClaims{
+				UserID: userID,
+				Role:   auth.RoleUser,
+				Scopes: auth.RoleUser.Scopes(),
+			})
+
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+			}
+			var got createdAPIKeyJson
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if auth.JoinScopes(got.Scopes) != test.wantScopes {
+				t.Errorf("scopes = %v, want %q", got.Scopes, test.wantScopes)
+			}
+		})
+	}
+}
+
+func TestUserWideRevocationRevokesAPIKeys(t *testing.T) {
+	user := database.User{ID: uuid.New(), Email: "walt@example.com", HashedPassword: "old-hash"}
+
+	t.Run("Password reset", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		cfg.passwordHasher = testPasswordHasher
+		cfg.passwordPolicy = auth.PasswordPolicy{MinLength: 8}
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(queryName("UsePasswordResetToken")).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(user.ID.String()))
+		mock.ExpectQuery(queryName("GetUserByID")).WillReturnRows(mockUserRows(user))
+		mock.ExpectQuery(queryName("UpdateUserPassword")).WillReturnRows(mockUserRows(user))
+		mock.ExpectExec(queryName("InvalidatePasswordResetTokens")).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(queryName("RevokeAllUserTokens")).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(queryName("RevokeUserAPIKeys")).
+			WithArgs(user.ID.String()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(queryName("SetUserTokenCutoff")).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		rec := httptest.NewRecorder()
+		cfg.handlerConfirmPasswordReset(rec, httptest.NewRequest(http.MethodPost, "/api/password-reset/confirm", strings.NewReader(
+			`{"token":"reset-token","password":"a brand new password"}`,
+		)))
+
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusNoContent, rec.Body)
+		}
+	})
+
+	t.Run("Password change", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		cfg.passwordHasher = testPasswordHasher
+		cfg.passwordPolicy = auth.PasswordPolicy{MinLength: 8}
+
+		mock.ExpectQuery(queryName("GetUserByID")).WillReturnRows(mockUserRows(user))
+		mock.ExpectBegin()
+		mock.ExpectQuery(queryName("UpdateUserPassword")).WillReturnRows(mockUserRows(user))
+		mock.ExpectExec(queryName("RevokeAllUserTokens")).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(queryName("RevokeUserAPIKeys")).
+			WithArgs(user.ID.String()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(queryName("SetUserTokenCutoff")).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, "/api/users", strings.NewReader(
+			`{"email":"walt@example.com","password":"a brand new password"}`,
+		))
+		cfg.handlerUpdateUser(rec, req, auth.AccessClaims{UserID: user.ID})
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+		}
+	})
+
+	t.Run("Logout everywhere", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+
+		mock.ExpectExec(queryName("RevokeAllUserTokens")).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(queryName("RevokeUserAPIKeys")).
+			WithArgs(user.ID.String()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(queryName("SetUserTokenCutoff")).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		rec := httptest.NewRecorder()
+		cfg.handlerLogoutAll(rec, httptest.NewRequest(http.MethodPost, "/api/logout-all", nil), auth.AccessClaims{UserID: user.ID})
+
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusNoContent, rec.Body)
+		}
+	})
+}
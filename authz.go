@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// authorizedHandler is a handler that has been given the verified claims of
+// the caller's access token.
+type authorizedHandler func(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims)
+
+// requireScopes authenticates the request and only calls handler when the
+// access token grants every one of scopes.
+func (cfg *apiConfig) requireScopes(handler authorizedHandler, scopes ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := cfg.authenticate(r)
+		if errors.Is(err, errCSRFTokenMismatch) {
+			respondWithJson(w, http.StatusForbidden, errorResponse{
+				Error: "Missing or invalid CSRF token",
+			})
+			return
+		}
+		if err != nil {
+			respondWithJson(w, http.StatusUnauthorized, errorResponse{
+				Error: fmt.Sprintf("User could not be authenticated: %v", err),
+			})
+			return
+		}
+		for _, scope := range scopes {
+			if !claims.HasScope(scope) {
+				respondWithJson(w, http.StatusForbidden, errorResponse{
+					Error: fmt.Sprintf("Token is missing the %s scope", scope),
+				})
+				return
+			}
+		}
+		handler(w, r, claims)
+	}
+}
+
+// viewerHandler is a handler for a public endpoint that personalises its
+// response for the caller, if they are known.
+type viewerHandler func(w http.ResponseWriter, r *http.Request, viewer uuid.NullUUID)
+
+// allowAnonymous calls handler for anonymous callers with an empty viewer.
+// Credentials that are presented are held to the same standard as in
+// requireScopes, so a token without every one of scopes is refused rather
+// than treated as anonymous.
+func (cfg *apiConfig) allowAnonymous(handler viewerHandler, scopes ...string) http.HandlerFunc {
+	authorized := cfg.requireScopes(func(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+		handler(w, r, uuid.NullUUID{UUID: claims.UserID, Valid: true})
+	}, scopes...)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !hasCredentials(r) {
+			handler(w, r, uuid.NullUUID{})
+			return
+		}
+		authorized(w, r)
+	}
+}
+
+func (cfg *apiConfig) handlerSetUserRole(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	type requestParams struct {
+		Role auth.Role `json:"role"`
+	}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Invalid user id provided",
+		})
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := requestParams{}
+	err = decoder.Decode(&params)
+	if err != nil || !params.Role.Valid() {
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "role must be user, moderator or admin",
+		})
+		return
+	}
+
+	// Stops the last admin from locking everyone out
+	if userID == claims.UserID {
+		respondWithJson(w, http.StatusForbidden, errorResponse{
+			Error: "You cannot change your own role",
+		})
+		return
+	}
+
+	tx, err := cfg.sqlDB.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Failed to begin transaction: %v", err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	rows, err := qtx.SetUserRole(r.Context(), database.SetUserRoleParams{
+		ID:   userID,
+		Role: string(params.Role),
+	})
+	if err == nil && rows == 0 {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "User does not exist",
+		})
+		return
+	}
+	// Access tokens carrying the old role stop working
+	var notBefore time.Time
+	if err == nil {
+		notBefore, err = storeUserTokenCutoff(r.Context(), qtx, userID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Failed to set role for user %s: %v", userID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	cfg.revocations.setCutoff(userID, notBefore)
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "User does not exist",
+		})
+		return
+	}
+
+	log.Printf("User %s given the %s role by %s", userID, params.Role, claims.UserID)
+	respondWithJson(w, http.StatusOK, newUserJson(user))
+}
+
+// bootstrapAdmin gives the account named by ADMIN_EMAIL the admin role so a
+// fresh deployment has someone able to manage roles.
+func (cfg *apiConfig) bootstrapAdmin(ctx context.Context) error {
+	email := os.Getenv("ADMIN_EMAIL")
+	if email == "" {
+		return nil
+	}
+	user, err := cfg.db.GetUserByEmail(ctx, email)
+	if err != nil {
+		return fmt.Errorf("ADMIN_EMAIL %q: %w", email, err)
+	}
+	if auth.Role(user.Role) == auth.RoleAdmin {
+		return nil
+	}
+	_, err = cfg.db.SetUserRole(ctx, database.SetUserRoleParams{
+		ID:   user.ID,
+		Role: string(auth.RoleAdmin),
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("User %s given the admin role from ADMIN_EMAIL", user.ID)
+	return nil
+}
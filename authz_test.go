@@ -0,0 +1,208 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+func TestAdminEndpointsRequireAdmin(t *testing.T) {
+	endpoints := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/admin/metrics"},
+		{http.MethodPost, "/admin/reset"},
+	}
+	tests := []struct {
+		name       string
+		role       auth.Role
+		wantStatus int
+	}{
+		{
+			name:       "Anonymous",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Regular user",
+			role:       auth.RoleUser,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Moderator",
+			role:       auth.RoleModerator,
+			wantStatus: http.StatusForbidden,
+		},
+	}
+	for _, endpoint := range endpoints {
+		for _, test := range tests {
+			t.Run(endpoint.path+"/"+test.name, func(t *testing.T) {
+				cfg, mock := newMockConfig(t)
+				useTestKeys(t, cfg)
+				// Reset would go ahead on its own in development
+				cfg.platform = "dev"
+
+				req := httptest.NewRequest(endpoint.method, endpoint.path, nil)
+				if test.role != "" {
+					expectAccessTokenChecks(mock)
+					req.Header.Set("Authorization", "Bearer "+bearerToken(t, cfg, uuid.New(), test.role))
+				}
+				rec := httptest.NewRecorder()
+				cfg.routes(t.TempDir()).ServeHTTP(rec, req)
+
+				if rec.Code != test.wantStatus {
+					t.Errorf("status = %d, want %d: %s", rec.Code, test.wantStatus, rec.Body)
+				}
+			})
+		}
+	}
+}
+
+func TestResetStillRequiresDevPlatform(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	useTestKeys(t, cfg)
+	cfg.platform = "prod"
+	expectAccessTokenChecks(mock)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/reset", nil)
+	req.Header.Set("Authorization", "Bearer "+bearerToken(t, cfg, uuid.New(), auth.RoleAdmin))
+	rec := httptest.NewRecorder()
+	cfg.routes(t.TempDir()).ServeHTTP(rec, req)
+
+	// No DeleteUsers query is expected, so the mock fails the test if one runs
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestMetricsAllowsAdmin(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	useTestKeys(t, cfg)
+	expectAccessTokenChecks(mock)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/metrics", nil)
+	req.Header.Set("Authorization", "Bearer "+bearerToken(t, cfg, uuid.New(), auth.RoleAdmin))
+	rec := httptest.NewRecorder()
+	cfg.routes(t.TempDir()).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+}
+
+func TestAllowAnonymous(t *testing.T) {
+	userID := uuid.New()
+	tests := []struct {
+		name       string
+		scopes     []string
+		token      string
+		wantStatus int
+		wantViewer bool
+	}{
+		{
+			name:       "No credentials",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Token with the scope",
+			scopes:     []string{auth.ScopeChirpsRead},
+			wantStatus: http.StatusOK,
+			wantViewer: true,
+		},
+		{
+			name:       "Token without the scope",
+			scopes:     []string{auth.ScopeUsersRead},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Invalid token",
+			token:      "not-a-token",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, mock := newMockConfig(t)
+			useTestKeys(t, cfg)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/chirps", nil)
+			token := test.token
+			if test.scopes != nil {
+				expectAccessTokenChecks(mock)
+				var err error
+				token, err = auth.MakeJWT(userID, auth.RoleUser, test.scopes, cfg.jwtKeys, time.Hour)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+
+			var gotViewer uuid.NullUUID
+			handler := cfg.allowAnonymous(func(w http.ResponseWriter, r *http.Request, viewer uuid.NullUUID) {
+				gotViewer = viewer
+				w.WriteHeader(http.StatusOK)
+			}, auth.ScopeChirpsRead)
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, test.wantStatus, rec.Body)
+			}
+			if gotViewer.Valid != test.wantViewer || (test.wantViewer && gotViewer.UUID != userID) {
+				t.Errorf("viewer = %+v, want set: %v", gotViewer, test.wantViewer)
+			}
+		})
+	}
+}
+
+func TestPublicReadsCheckScopes(t *testing.T) {
+	chirpID := uuid.NewString()
+	userID := uuid.NewString()
+	endpoints := []struct {
+		path  string
+		scope string
+	}{
+		{"/api/chirps", auth.ScopeChirpsRead},
+		{"/api/chirps/" + chirpID, auth.ScopeChirpsRead},
+		{"/api/chirps/" + chirpID + "/revisions", auth.ScopeChirpsRead},
+		{"/api/chirps/" + chirpID + "/thread", auth.ScopeChirpsRead},
+		{"/api/users/" + userID, auth.ScopeUsersRead},
+		{"/api/users/" + userID + "/likes", auth.ScopeChirpsRead},
+		{"/api/users/" + userID + "/followers", auth.ScopeUsersRead},
+		{"/api/users/" + userID + "/following", auth.ScopeUsersRead},
+	}
+	for _, endpoint := range endpoints {
+		t.Run(endpoint.path, func(t *testing.T) {
+			cfg, mock := newMockConfig(t)
+			useTestKeys(t, cfg)
+			expectAccessTokenChecks(mock)
+
+			// A token that can do anything but read this endpoint
+			var scopes []string
+			for _, scope := range auth.RoleUser.Scopes() {
+				if scope != endpoint.scope {
+					scopes = append(scopes, scope)
+				}
+			}
+			token, err := auth.MakeJWT(uuid.New(), auth.RoleUser, scopes, cfg.jwtKeys, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, endpoint.path, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			cfg.routes(t.TempDir()).ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusForbidden, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type chirpRevisionJson struct {
+	ID         uuid.UUID `json:"id"`
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+// handlerUpdateChirp lets the author change a chirp's body. The body it
+// replaces is kept as a revision.
+func (cfg *apiConfig) handlerUpdateChirp(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "Invalid chirp id provided",
+		})
+		return
+	}
+
+	type requestParams struct {
+		Body string `json:"body"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := requestParams{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "Couldn't decode parameters",
+		})
+		return
+	}
+
+	if len(params.Body) > maxChirpLength {
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "Chrip is too long",
+		})
+		return
+	}
+
+	tx, err := cfg.sqlDB.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Failed to begin transaction: %v", err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	// Locking the row keeps concurrent edits from losing a revision
+	chirp, err := qtx.GetChirpForUpdate(r.Context(), chirpID)
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Chirp does not exist",
+		})
+		return
+	}
+	if chirp.UserID != claims.UserID {
+		respondWithJson(w, http.StatusForbidden, errorResponse{
+			Error: "You are not the owner of this chirp",
+		})
+		return
+	}
+	if chirp.RechirpOfID.Valid {
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "Rechirps have no body to edit",
+		})
+		return
+	}
+	if chirp.QuoteOfID.Valid && strings.TrimSpace(params.Body) == "" {
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "A quote chirp needs a body, rechirp instead to share without one",
+		})
+		return
+	}
+
+	body := replaceProfanity(params.Body)
+	if body == chirp.Body {
+		tx.Rollback()
+		cfg.respondWithChirp(w, r, http.StatusOK, chirp, uuid.NullUUID{UUID: claims.UserID, Valid: true})
+		return
+	}
+
+	err = qtx.CreateChirpRevision(r.Context(), database.CreateChirpRevisionParams{
+		CreatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		ChirpID:   chirp.ID,
+	})
+	if err == nil {
+		chirp, err = qtx.UpdateChirpBody(r.Context(), database.UpdateChirpBodyParams{
+			ID:   chirp.ID,
+			Body: body,
+		})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Failed to update chirp %s: %v", chirpID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	log.Printf("Chirp %s was edited by %s", chirpID, claims.UserID)
+	cfg.respondWithChirp(w, r, http.StatusOK, chirp, uuid.NullUUID{UUID: claims.UserID, Valid: true})
+}
+
+// handlerChirpRevisions lists the earlier bodies of a chirp, newest first.
+func (cfg *apiConfig) handlerChirpRevisions(w http.ResponseWriter, r *http.Request, _ uuid.NullUUID) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Invalid chirp id provided",
+		})
+		return
+	}
+
+	if _, err := cfg.db.GetChirp(r.Context(), chirpID); err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Chirp does not exist",
+		})
+		return
+	}
+
+	revisions, err := cfg.db.ListChirpRevisions(r.Context(), chirpID)
+	if err != nil {
+		log.Printf("Failed to list revisions of chirp %s: %v", chirpID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	response := []chirpRevisionJson{}
+	for _, revision := range revisions {
+		response = append(response, chirpRevisionJson{
+			ID:         revision.ID,
+			Body:       revision.Body,
+			CreatedAt:  revision.CreatedAt,
+			ReplacedAt: revision.ReplacedAt,
+		})
+	}
+	respondWithJson(w, http.StatusOK, response)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type threadJson struct {
+	// Ancestors run from the start of the conversation down to the parent
+	Ancestors  []chirpJson `json:"ancestors"`
+	Chirp      chirpJson   `json:"chirp"`
+	Replies    []chirpJson `json:"replies"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// handlerChirpThread returns the conversation around a chirp: every chirp it
+// replies to and a page of all replies beneath it, oldest first.
+func (cfg *apiConfig) handlerChirpThread(w http.ResponseWriter, r *http.Request, viewer uuid.NullUUID) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Invalid chirp id provided",
+		})
+		return
+	}
+
+	limit, err := parseLimit(r)
+	if err != nil {
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	cursorCreatedAt := sql.NullTime{}
+	cursorID := uuid.NullUUID{}
+	if cursorStr := r.URL.Query().Get("cursor"); cursorStr != "" {
+		cursor, err := decodeCursor(cursorStr)
+		if err != nil {
+			respondWithJson(w, http.StatusBadRequest, errorResponse{
+				Error: "Invalid cursor provided",
+			})
+			return
+		}
+		cursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		cursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+
+	chirp, err := cfg.db.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Chirp does not exist",
+		})
+		return
+	}
+
+	ancestors, err := cfg.db.ListChirpAncestors(r.Context(), chirpID)
+	if err != nil {
+		log.Printf("Failed to load ancestors of chirp %s: %v", chirpID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	// Fetch one extra row to find out whether another page follows
+	descendants, err := cfg.db.ListChirpDescendants(r.Context(), database.ListChirpDescendantsParams{
+		ChirpID:         chirpID,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		Limit:           int32(limit + 1),
+	})
+	if err != nil {
+		log.Printf("Failed to load replies to chirp %s: %v", chirpID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	thread := threadJson{}
+	if len(descendants) > limit {
+		descendants = descendants[:limit]
+		last := descendants[len(descendants)-1]
+		thread.NextCursor = encodeCursor(pageCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	// Everything is converted together so the counts take a single query
+	chirps := make([]database.Chirp, 0, len(ancestors)+1+len(descendants))
+	for _, ancestor := range ancestors {
+		chirps = append(chirps, database.Chirp(ancestor))
+	}
+	chirps = append(chirps, chirp)
+	for _, descendant := range descendants {
+		chirps = append(chirps, database.Chirp(descendant))
+	}
+	converted, err := cfg.newChirpsJson(r.Context(), chirps, viewer)
+	if err != nil {
+		log.Printf("Failed to load thread details for chirp %s: %v", chirpID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	thread.Ancestors = converted[:len(ancestors)]
+	thread.Chirp = converted[len(ancestors)]
+	thread.Replies = converted[len(ancestors)+1:]
+	respondWithJson(w, http.StatusOK, thread)
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestDeleteChirpTombstonesOnlyWithReplies(t *testing.T) {
+	tests := []struct {
+		name        string
+		hasReplies  bool
+		wantQueries []string
+	}{
+		{
+			name:        "Chirp with replies or quotes becomes a tombstone",
+			hasReplies:  true,
+			wantQueries: []string{"DeleteChirpRevisions", "DeleteRechirps"},
+		},
+		{
+			name:        "Chirp without replies or quotes is deleted",
+			wantQueries: []string{"DeleteChirp"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, mock := newMockConfig(t)
+			chirp := database.Chirp{ID: uuid.New(), Body: "hello", UserID: uuid.New()}
+
+			mock.ExpectQuery(queryName("GetChirp")).WillReturnRows(mockChirpRows(chirp))
+			mock.ExpectBegin()
+			// The query only tombstones when a reply or quote exists
+			tombstoned := int64(0)
+			if test.hasReplies {
+				tombstoned = 1
+			}
+			mock.ExpectExec(queryName("TombstoneChirp")).
+				WithArgs(chirp.ID.String()).
+				WillReturnResult(sqlmock.NewResult(0, tombstoned))
+			for _, query := range test.wantQueries {
+				mock.ExpectExec(queryName(query)).
+					WithArgs(chirp.ID.String()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			mock.ExpectCommit()
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/chirps/"+chirp.ID.String(), nil)
+			req.SetPathValue("chirpID", chirp.ID.String())
+			rec := httptest.NewRecorder()
+			cfg.handlerDeleteChirps(rec, req, auth.AccessClaims{UserID: chirp.UserID})
+
+			if rec.Code != http.StatusNoContent {
+				t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusNoContent, rec.Body)
+			}
+		})
+	}
+}
+
+func TestGetChirpHidesTombstones(t *testing.T) {
+	chirpID := uuid.New()
+	hidesTombstones := queryName("GetChirp") + `(?s).*AND deleted_at IS NULL`
+
+	t.Run("Single chirp", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		mock.ExpectQuery(hidesTombstones).WillReturnError(sql.ErrNoRows)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/chirps/"+chirpID.String(), nil)
+		req.SetPathValue("chirpID", chirpID.String())
+		rec := httptest.NewRecorder()
+		cfg.handlerGetChirp(rec, req, uuid.NullUUID{})
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+		}
+	})
+
+	t.Run("Thread", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		mock.ExpectQuery(hidesTombstones).WillReturnError(sql.ErrNoRows)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/chirps/"+chirpID.String()+"/thread", nil)
+		req.SetPathValue("chirpID", chirpID.String())
+		rec := httptest.NewRecorder()
+		cfg.handlerChirpThread(rec, req, uuid.NullUUID{})
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+		}
+	})
+
+	t.Run("Replying to a deleted chirp", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		mock.ExpectQuery(hidesTombstones).WillReturnError(sql.ErrNoRows)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/chirps", strings.NewReader(
+			`{"body":"hi","reply_to_id":"`+chirpID.String()+`"}`,
+		))
+		rec := httptest.NewRecorder()
+		cfg.handlerCreateChirps(rec, req, auth.AccessClaims{UserID: uuid.New()})
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestReplyToRechirpRepliesToOriginal(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	userID := uuid.New()
+	original := database.Chirp{ID: uuid.New(), Body: "original", UserID: uuid.New()}
+	rechirp := database.Chirp{
+		ID:          uuid.New(),
+		UserID:      uuid.New(),
+		RechirpOfID: uuid.NullUUID{UUID: original.ID, Valid: true},
+	}
+	reply := database.Chirp{
+		ID:        uuid.New(),
+		Body:      "nice",
+		UserID:    userID,
+		ReplyToID: uuid.NullUUID{UUID: original.ID, Valid: true},
+	}
+
+	mock.ExpectQuery(queryName("GetChirp")).
+		WithArgs(rechirp.ID.String()).
+		WillReturnRows(mockChirpRows(rechirp))
+	mock.ExpectQuery(queryName("CreateChirp")).
+		WithArgs("nice", userID.String(), original.ID.String(), nil, nil).
+		WillReturnRows(mockChirpRows(reply))
+	expectChirpCounts(mock, chirpCounts{})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/chirps", strings.NewReader(
+		`{"body":"nice","reply_to_id":"`+rechirp.ID.String()+`"}`,
+	))
+	rec := httptest.NewRecorder()
+	cfg.handlerCreateChirps(rec, req, auth.AccessClaims{UserID: userID})
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+	var got chirpJson
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ReplyToID == nil || *got.ReplyToID != original.ID {
+		t.Errorf("reply_to_id = %v, want the original %s", got.ReplyToID, original.ID)
+	}
+}
+
+func TestChirpThreadPaging(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	start := time.Now().UTC().Truncate(time.Second)
+	reply := func(parent database.Chirp, minutes int) database.Chirp {
+		return database.Chirp{
+			ID:        uuid.New(),
+			CreatedAt: start.Add(time.Duration(minutes) * time.Minute),
+			UpdatedAt: start.Add(time.Duration(minutes) * time.Minute),
+			Body:      "reply",
+			UserID:    uuid.New(),
+			ReplyToID: uuid.NullUUID{UUID: parent.ID, Valid: true},
+		}
+	}
+	root := database.Chirp{ID: uuid.New(), CreatedAt: start, UpdatedAt: start, Body: "root", UserID: uuid.New()}
+	parent := reply(root, 1)
+	chirp := reply(parent, 2)
+	seen := reply(chirp, 3)
+	first := reply(chirp, 4)
+	second := reply(first, 5)
+	extra := reply(chirp, 6)
+
+	mock.ExpectQuery(queryName("GetChirp")).WillReturnRows(mockChirpRows(chirp))
+	mock.ExpectQuery(queryName("ListChirpAncestors")).
+		WithArgs(chirp.ID.String()).
+		WillReturnRows(mockChirpRows(root, parent))
+	// One extra row shows there is a next page
+	mock.ExpectQuery(queryName("ListChirpDescendants")).
+		WithArgs(chirp.ID.String(), seen.CreatedAt, seen.ID.String(), 3).
+		WillReturnRows(mockChirpRows(first, second, extra))
+	expectChirpCounts(mock, chirpCounts{
+		replies: sqlmock.NewRows([]string{"chirp_id", "reply_count"}).
+			AddRow(parent.ID.String(), 1).
+			AddRow(chirp.ID.String(), 3),
+	})
+
+	cursor := encodeCursor(pageCursor{CreatedAt: seen.CreatedAt, ID: seen.ID})
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps/"+chirp.ID.String()+"/thread?limit=2&cursor="+cursor, nil)
+	req.SetPathValue("chirpID", chirp.ID.String())
+	rec := httptest.NewRecorder()
+	cfg.handlerChirpThread(rec, req, uuid.NullUUID{})
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var got threadJson
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.Ancestors) != 2 || got.Ancestors[0].ID != root.ID || got.Ancestors[1].ID != parent.ID {
+		t.Errorf("ancestors = %+v, want root then parent", got.Ancestors)
+	}
+	if got.Chirp.ID != chirp.ID || got.Chirp.ReplyCount != 3 {
+		t.Errorf("chirp = %+v, want %s with 3 replies", got.Chirp, chirp.ID)
+	}
+	if len(got.Replies) != 2 || got.Replies[0].ID != first.ID || got.Replies[1].ID != second.ID {
+		t.Errorf("replies = %+v, want first and second", got.Replies)
+	}
+	next, err := decodeCursor(got.NextCursor)
+	if err != nil {
+		t.Fatalf("next_cursor %q: %v", got.NextCursor, err)
+	}
+	if next.ID != second.ID || !next.CreatedAt.Equal(second.CreatedAt) {
+		t.Errorf("next_cursor = %+v, want the last reply on the page", next)
+	}
+}
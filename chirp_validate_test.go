@@ -2,6 +2,9 @@ package main
 
 import (
 	"testing"
+	"time"
+
+	"github.com/JakeBurrell/chirpy/internal/database"
 )
 
 func TestResplaceProfanity(t *testing.T) {
@@ -12,3 +15,23 @@ func TestResplaceProfanity(t *testing.T) {
 		t.Errorf("replaceProfanity(%s) = %s\n want = %s", testText, got, want)
 	}
 }
+
+func TestChirpEditedFlag(t *testing.T) {
+	posted := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		updatedAt time.Time
+		want      bool
+	}{
+		{name: "Never edited", updatedAt: posted, want: false},
+		{name: "Edited", updatedAt: posted.Add(time.Minute), want: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := newChirpJson(database.Chirp{CreatedAt: posted, UpdatedAt: test.updatedAt})
+			if got.Edited != test.want {
+				t.Errorf("newChirpJson().Edited = %v, want %v", got.Edited, test.want)
+			}
+		})
+	}
+}
@@ -1,8 +1,9 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
 	"slices"
@@ -14,15 +15,152 @@ import (
 	"github.com/google/uuid"
 )
 
+const maxChirpLength = 140
+
 type chirpJson struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Body       string     `json:"body"`
+	UserID     uuid.UUID  `json:"user_id"`
+	Edited     bool       `json:"edited"`
+	ReplyToID  *uuid.UUID `json:"reply_to_id"`
+	ReplyCount int64      `json:"reply_count"`
+	LikeCount  int64      `json:"like_count"`
+	// RechirpCount counts rechirps only, not quotes
+	RechirpCount int64 `json:"rechirp_count"`
+	// LikedByMe is only set when the caller is logged in
+	LikedByMe *bool `json:"liked_by_me,omitempty"`
+	// Deleted chirps only appear in threads, to hold their replies together
+	Deleted bool `json:"deleted,omitempty"`
+	// A rechirp has no body of its own and embeds the chirp it shares
+	RechirpOf   *chirpJson `json:"rechirp_of,omitempty"`
+	QuotedChirp *chirpJson `json:"quoted_chirp,omitempty"`
+}
+
+func newChirpJson(chirp database.Chirp) chirpJson {
+	response := chirpJson{
+		ID:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		UserID:    chirp.UserID,
+		// Only edits change updated_at
+		Edited:  chirp.UpdatedAt.After(chirp.CreatedAt),
+		Deleted: chirp.DeletedAt.Valid,
+	}
+	if chirp.ReplyToID.Valid {
+		response.ReplyToID = &chirp.ReplyToID.UUID
+	}
+	return response
+}
+
+// newChirpsJson converts chirps for a response, embedding the chirps they
+// rechirp or quote. Everything is loaded in a fixed number of queries rather
+// than one per chirp. When viewer is set each chirp also says whether the
+// viewer has liked it.
+func (cfg *apiConfig) newChirpsJson(ctx context.Context, chirps []database.Chirp, viewer uuid.NullUUID) ([]chirpJson, error) {
+	embeddedIDs := []uuid.UUID{}
+	for _, chirp := range chirps {
+		if chirp.RechirpOfID.Valid {
+			embeddedIDs = append(embeddedIDs, chirp.RechirpOfID.UUID)
+		}
+		if chirp.QuoteOfID.Valid {
+			embeddedIDs = append(embeddedIDs, chirp.QuoteOfID.UUID)
+		}
+	}
+	all := chirps
+	if len(embeddedIDs) > 0 {
+		// Includes tombstones, so quotes can show the original was deleted
+		embedded, err := cfg.db.ListChirpsByIDs(ctx, embeddedIDs)
+		if err != nil {
+			return nil, err
+		}
+		all = append(slices.Clip(chirps), embedded...)
+	}
+
+	converted, err := cfg.newChirpsJsonWithCounts(ctx, all, viewer)
+	if err != nil {
+		return nil, err
+	}
+	embedded := map[uuid.UUID]chirpJson{}
+	for _, item := range converted[len(chirps):] {
+		embedded[item.ID] = item
+	}
+
+	response := converted[:len(chirps)]
+	for i, chirp := range chirps {
+		if original, ok := embedded[chirp.RechirpOfID.UUID]; ok && chirp.RechirpOfID.Valid {
+			response[i].RechirpOf = &original
+		}
+		if quoted, ok := embedded[chirp.QuoteOfID.UUID]; ok && chirp.QuoteOfID.Valid {
+			response[i].QuotedChirp = &quoted
+		}
+	}
+	return response, nil
+}
+
+func (cfg *apiConfig) newChirpsJsonWithCounts(ctx context.Context, chirps []database.Chirp, viewer uuid.NullUUID) ([]chirpJson, error) {
+	ids := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.ID)
+	}
+	counts, err := cfg.db.CountChirpReplies(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	replyCounts := map[uuid.UUID]int64{}
+	for _, count := range counts {
+		replyCounts[count.ChirpID] = count.ReplyCount
+	}
+	rechirps, err := cfg.db.CountChirpRechirps(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	rechirpCounts := map[uuid.UUID]int64{}
+	for _, count := range rechirps {
+		rechirpCounts[count.ChirpID] = count.RechirpCount
+	}
+	likes, err := cfg.db.CountChirpLikes(ctx, database.CountChirpLikesParams{
+		ViewerID: viewer,
+		ChirpIds: ids,
+	})
+	if err != nil {
+		return nil, err
+	}
+	likeCounts := map[uuid.UUID]database.CountChirpLikesRow{}
+	for _, count := range likes {
+		likeCounts[count.ChirpID] = count
+	}
+
+	response := make([]chirpJson, 0, len(chirps))
+	for _, chirp := range chirps {
+		item := newChirpJson(chirp)
+		item.ReplyCount = replyCounts[chirp.ID]
+		item.LikeCount = likeCounts[chirp.ID].LikeCount
+		item.RechirpCount = rechirpCounts[chirp.ID]
+		if viewer.Valid {
+			liked := likeCounts[chirp.ID].LikedByViewer
+			item.LikedByMe = &liked
+		}
+		response = append(response, item)
+	}
+	return response, nil
+}
+
+func (cfg *apiConfig) respondWithChirp(w http.ResponseWriter, r *http.Request, code int, chirp database.Chirp, viewer uuid.NullUUID) {
+	response, err := cfg.newChirpsJson(r.Context(), []database.Chirp{chirp}, viewer)
+	if err != nil {
+		log.Printf("Failed to load chirp %s details: %v", chirp.ID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	respondWithJson(w, code, response[0])
 }
 
-func (cfg *apiConfig) handlerGetChirp(w http.ResponseWriter, r *http.Request) {
+func (cfg *apiConfig) handlerGetChirp(w http.ResponseWriter, r *http.Request, viewer uuid.NullUUID) {
 	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
 		log.Printf("Invalid chirp id: %v", err)
@@ -40,67 +178,131 @@ func (cfg *apiConfig) handlerGetChirp(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	respondWithJson(w, http.StatusOK, chirpJson{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserID:    chirp.UserID,
-	})
+	cfg.respondWithChirp(w, r, http.StatusOK, chirp, viewer)
 
 }
 
-func (cfg *apiConfig) handlerAllChirps(w http.ResponseWriter, r *http.Request) {
-	chirps, err := cfg.db.GetAllChirps(r.Context())
-	if err != nil {
-		log.Printf("Could not retrieve chirps: %v", err)
-		respondWithJson(w, http.StatusInternalServerError, errorResponse{
-			Error: "Failed to retrieve chirps from database",
+type chirpsPageJson struct {
+	Chirps     []chirpJson `json:"chirps"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+func (cfg *apiConfig) handlerAllChirps(w http.ResponseWriter, r *http.Request, viewer uuid.NullUUID) {
+	query := r.URL.Query()
+
+	authorID := uuid.NullUUID{}
+	if authorStr := query.Get("author_id"); authorStr != "" {
+		id, err := uuid.Parse(authorStr)
+		if err != nil {
+			respondWithJson(w, http.StatusBadRequest, errorResponse{
+				Error: "Invalid author id provided",
+			})
+			return
+		}
+		authorID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	sortOrder := query.Get("sort")
+	if sortOrder == "" {
+		sortOrder = "asc"
+	}
+	if sortOrder != "asc" && sortOrder != "desc" {
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "sort must be asc or desc",
 		})
 		return
 	}
 
-	jsonChirps := []chirpJson{}
-	for _, chirp := range chirps {
-		jsonChirps = append(jsonChirps, chirpJson{
-			ID:        chirp.ID,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-			Body:      chirp.Body,
-			UserID:    chirp.UserID,
+	limit, err := parseLimit(r)
+	if err != nil {
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: err.Error(),
 		})
+		return
 	}
 
-	respondWithJson(w, http.StatusOK, jsonChirps)
+	cursorCreatedAt := sql.NullTime{}
+	cursorID := uuid.NullUUID{}
+	if cursorStr := query.Get("cursor"); cursorStr != "" {
+		cursor, err := decodeCursor(cursorStr)
+		if err != nil {
+			respondWithJson(w, http.StatusBadRequest, errorResponse{
+				Error: "Invalid cursor provided",
+			})
+			return
+		}
+		cursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		cursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
 
-}
+	// Clients that don't ask for a page get every chirp as a plain array,
+	// as they did before pagination existed
+	paged := query.Has("limit") || query.Has("cursor")
 
-func (cfg *apiConfig) handlerDeleteChirps(w http.ResponseWriter, r *http.Request) {
-	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	// Fetch one extra row to find out whether another page follows
+	fetchLimit := sql.NullInt32{}
+	if paged {
+		fetchLimit = sql.NullInt32{Int32: int32(limit + 1), Valid: true}
+	}
+	var chirps []database.Chirp
+	if sortOrder == "asc" {
+		chirps, err = cfg.db.ListChirpsAsc(r.Context(), database.ListChirpsAscParams{
+			AuthorID:        authorID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			Limit:           fetchLimit,
+		})
+	} else {
+		chirps, err = cfg.db.ListChirpsDesc(r.Context(), database.ListChirpsDescParams{
+			AuthorID:        authorID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			Limit:           fetchLimit,
+		})
+	}
 	if err != nil {
-		log.Printf("Invalid chirp id: %v", err)
-		respondWithJson(w, http.StatusBadRequest, errorResponse{
-			Error: "Invalid chirp id provided",
+		log.Printf("Could not retrieve chirps: %v", err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Failed to retrieve chirps from database",
 		})
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
+	page := chirpsPageJson{}
+	if paged && len(chirps) > limit {
+		chirps = chirps[:limit]
+		last := chirps[len(chirps)-1]
+		page.NextCursor = encodeCursor(pageCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	page.Chirps, err = cfg.newChirpsJson(r.Context(), chirps, viewer)
 	if err != nil {
-		respondWithJson(w, http.StatusUnauthorized, errorResponse{
-			Error: fmt.Sprintf("Failed to validate authorization: %v", err),
+		log.Printf("Could not retrieve chirp details: %v", err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Failed to retrieve chirps from database",
 		})
 		return
 	}
 
-	loggedInID, err := auth.ValidateJWT(token, cfg.secret)
+	if !paged {
+		respondWithJson(w, http.StatusOK, page.Chirps)
+		return
+	}
+	respondWithJson(w, http.StatusOK, page)
+
+}
+
+func (cfg *apiConfig) handlerDeleteChirps(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
-		respondWithJson(w, http.StatusUnauthorized, errorResponse{
-			Error: fmt.Sprintf("Invalid token: %v", err),
+		log.Printf("Invalid chirp id: %v", err)
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "Invalid chirp id provided",
 		})
 		return
 	}
 
+	loggedInID := claims.UserID
+
 	chirp, err := cfg.db.GetChirp(r.Context(), chirpID)
 	if err != nil {
 		respondWithJson(w, http.StatusNotFound, errorResponse{
@@ -109,15 +311,42 @@ func (cfg *apiConfig) handlerDeleteChirps(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if chirp.UserID != loggedInID {
+	// Moderators may remove anyone's chirps
+	if chirp.UserID != loggedInID && !claims.HasScope(auth.ScopeChirpsModerate) {
 		respondWithJson(w, http.StatusForbidden, errorResponse{
 			Error: "You are not the owner of this chirp",
 		})
 		return
 	}
 
-	err = cfg.db.DeleteChirp(r.Context(), chirpID)
+	tx, err := cfg.sqlDB.BeginTx(r.Context(), nil)
 	if err != nil {
+		log.Printf("Failed to begin transaction: %v", err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	// Chirps with replies or quotes become tombstones so their threads and
+	// quotes stay intact. Rechirps of them go either way.
+	tombstoned, err := qtx.TombstoneChirp(r.Context(), chirpID)
+	if err == nil && tombstoned > 0 {
+		err = qtx.DeleteChirpRevisions(r.Context(), chirpID)
+	}
+	if err == nil && tombstoned > 0 {
+		err = qtx.DeleteRechirps(r.Context(), uuid.NullUUID{UUID: chirpID, Valid: true})
+	}
+	if err == nil && tombstoned == 0 {
+		err = qtx.DeleteChirp(r.Context(), chirpID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Failed to delete chirp %s: %v", chirpID, err)
 		respondWithJson(w, http.StatusInternalServerError, errorResponse{
 			Error: "Something went wrong",
 		})
@@ -125,15 +354,15 @@ func (cfg *apiConfig) handlerDeleteChirps(w http.ResponseWriter, r *http.Request
 	}
 
 	respondWithJson(w, http.StatusNoContent, nil)
-	log.Printf("Chirp %s was deleted", chirpID)
+	log.Printf("Chirp %s was deleted by %s", chirpID, loggedInID)
 
 }
 
-func (cfg *apiConfig) handlerCreateChirps(w http.ResponseWriter, r *http.Request) {
-	const sizeLimit int = 140
-
+func (cfg *apiConfig) handlerCreateChirps(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
 	type requestParams struct {
-		Body string `json:"body"`
+		Body      string        `json:"body"`
+		ReplyToID uuid.NullUUID `json:"reply_to_id"`
+		QuoteOfID uuid.NullUUID `json:"quote_of_id"`
 	}
 
 	// Decode Body
@@ -148,33 +377,64 @@ func (cfg *apiConfig) handlerCreateChirps(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Validate user
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithJson(w, http.StatusUnauthorized, errorResponse{
-			Error: fmt.Sprintf("Failed to validate authorization: %v", err),
-		})
+	loggedInID := claims.UserID
+
+	if !cfg.checkCanPost(w, r, loggedInID) {
 		return
 	}
-	loggedInID, err := auth.ValidateJWT(token, cfg.secret)
-	if err != nil {
-		respondWithJson(w, http.StatusUnauthorized, errorResponse{
-			Error: err.Error(),
+
+	if len(params.Body) > maxChirpLength {
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "Chrip is too long",
 		})
 		return
 	}
 
-	if len(params.Body) > sizeLimit {
+	if params.QuoteOfID.Valid && strings.TrimSpace(params.Body) == "" {
 		respondWithJson(w, http.StatusBadRequest, errorResponse{
-			Error: "Chrip is too long",
+			Error: "A quote chirp needs a body, rechirp instead to share without one",
 		})
 		return
 	}
 
+	// Replies and quotes of a rechirp refer to the chirp it shares
+	if params.ReplyToID.Valid {
+		parent, err := cfg.db.GetChirp(r.Context(), params.ReplyToID.UUID)
+		if err != nil {
+			respondWithJson(w, http.StatusBadRequest, errorResponse{
+				Error: "The chirp being replied to does not exist",
+			})
+			return
+		}
+		if parent.RechirpOfID.Valid {
+			params.ReplyToID = parent.RechirpOfID
+		}
+	}
+	if params.QuoteOfID.Valid {
+		quoted, err := cfg.db.GetChirp(r.Context(), params.QuoteOfID.UUID)
+		if err != nil {
+			respondWithJson(w, http.StatusBadRequest, errorResponse{
+				Error: "The chirp being quoted does not exist",
+			})
+			return
+		}
+		if quoted.RechirpOfID.Valid {
+			params.QuoteOfID = quoted.RechirpOfID
+		}
+	}
+
 	chirp, err := cfg.db.CreateChirp(r.Context(), database.CreateChirpParams{
-		Body:   replaceProfanity(params.Body),
-		UserID: loggedInID,
+		Body:      replaceProfanity(params.Body),
+		UserID:    loggedInID,
+		ReplyToID: params.ReplyToID,
+		QuoteOfID: params.QuoteOfID,
 	})
+	if isForeignKeyViolation(err) {
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "The chirp being replied to or quoted does not exist",
+		})
+		return
+	}
 	if err != nil {
 		log.Printf("Failed to add chirp to database: %v for user %s", err, loggedInID)
 		respondWithJson(w, http.StatusInternalServerError, errorResponse{
@@ -183,16 +443,32 @@ func (cfg *apiConfig) handlerCreateChirps(w http.ResponseWriter, r *http.Request
 		return
 	}
 	log.Printf("New chirp Created")
-	respondWithJson(w, http.StatusCreated, chirpJson{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserID:    loggedInID,
-	})
+	cfg.respondWithChirp(w, r, http.StatusCreated, chirp, uuid.NullUUID{UUID: loggedInID, Valid: true})
 
 }
 
+// checkCanPost responds with an error and returns false when the user isn't
+// allowed to post chirps yet.
+func (cfg *apiConfig) checkCanPost(w http.ResponseWriter, r *http.Request, userID uuid.UUID) bool {
+	if !cfg.requireVerifiedEmail {
+		return true
+	}
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithJson(w, http.StatusUnauthorized, errorResponse{
+			Error: "User does not exist",
+		})
+		return false
+	}
+	if !user.EmailVerifiedAt.Valid {
+		respondWithJson(w, http.StatusForbidden, errorResponse{
+			Error: "Verify your email address before posting chirps",
+		})
+		return false
+	}
+	return true
+}
+
 func replaceProfanity(chirp string) string {
 	profanities := []string{"kerfuffle", "sharbert", "fornax"}
 	cleaned := []string{}
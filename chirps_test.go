@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestAllChirpsResponseShape(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	first := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "first", UserID: uuid.New()}
+	second := database.Chirp{ID: uuid.New(), CreatedAt: now.Add(time.Minute), UpdatedAt: now, Body: "second", UserID: uuid.New()}
+
+	t.Run("No paging parameters returns every chirp as an array", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		// A NULL limit means no limit
+		mock.ExpectQuery(queryName("ListChirpsAsc")).
+			WithArgs(nil, nil, nil, nil).
+			WillReturnRows(mockChirpRows(first, second))
+		expectChirpCounts(mock, chirpCounts{})
+
+		rec := httptest.NewRecorder()
+		cfg.handlerAllChirps(rec, httptest.NewRequest(http.MethodGet, "/api/chirps", nil), uuid.NullUUID{})
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+		}
+		var got []chirpJson
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("response is not an array: %v: %s", err, rec.Body)
+		}
+		if len(got) != 2 || got[0].ID != first.ID || got[1].ID != second.ID {
+			t.Errorf("chirps = %+v, want first and second", got)
+		}
+	})
+
+	t.Run("A limit returns a page with a cursor", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		// One extra row shows there is a next page
+		mock.ExpectQuery(queryName("ListChirpsAsc")).
+			WithArgs(nil, nil, nil, 2).
+			WillReturnRows(mockChirpRows(first, second))
+		expectChirpCounts(mock, chirpCounts{})
+
+		rec := httptest.NewRecorder()
+		cfg.handlerAllChirps(rec, httptest.NewRequest(http.MethodGet, "/api/chirps?limit=1", nil), uuid.NullUUID{})
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+		}
+		var got chirpsPageJson
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("response is not a page: %v: %s", err, rec.Body)
+		}
+		if len(got.Chirps) != 1 || got.Chirps[0].ID != first.ID {
+			t.Errorf("chirps = %+v, want only first", got.Chirps)
+		}
+		cursor, err := decodeCursor(got.NextCursor)
+		if err != nil {
+			t.Fatalf("next_cursor %q: %v", got.NextCursor, err)
+		}
+		if cursor.ID != first.ID || !cursor.CreatedAt.Equal(first.CreatedAt) {
+			t.Errorf("next_cursor = %+v, want the last chirp on the page", cursor)
+		}
+	})
+
+	t.Run("A cursor alone also returns a page", func(t *testing.T) {
+		cfg, mock := newMockConfig(t)
+		cursor := encodeCursor(pageCursor{CreatedAt: first.CreatedAt, ID: first.ID})
+		mock.ExpectQuery(queryName("ListChirpsAsc")).
+			WithArgs(nil, first.CreatedAt, first.ID.String(), defaultPageLimit+1).
+			WillReturnRows(mockChirpRows(second))
+		expectChirpCounts(mock, chirpCounts{})
+
+		rec := httptest.NewRecorder()
+		cfg.handlerAllChirps(rec, httptest.NewRequest(http.MethodGet, "/api/chirps?cursor="+cursor, nil), uuid.NullUUID{})
+
+		var got chirpsPageJson
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("response is not a page: %v: %s", err, rec.Body)
+		}
+		if len(got.Chirps) != 1 || got.NextCursor != "" {
+			t.Errorf("page = %+v, want one chirp and no cursor", got)
+		}
+	})
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// newMockConfig returns a config backed by a mock database. Queries must be
+// expected in the order they run, and the test fails if any expected query
+// doesn't run or an unexpected one does.
+func newMockConfig(t *testing.T) (*apiConfig, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	return &apiConfig{
+		db:          database.New(db),
+		sqlDB:       db,
+		revocations: newRevocationCache(),
+	}, mock
+}
+
+// queryName matches the sqlc query with the given name.
+func queryName(name string) string {
+	return regexp.QuoteMeta("-- name: " + name + " ")
+}
+
+var chirpColumns = []string{
+	"id", "created_at", "updated_at", "body", "user_id",
+	"reply_to_id", "deleted_at", "rechirp_of_id", "quote_of_id",
+}
+
+func nullUUIDValue(id uuid.NullUUID) driver.Value {
+	if !id.Valid {
+		return nil
+	}
+	return id.UUID.String()
+}
+
+func mockChirpRows(chirps ...database.Chirp) *sqlmock.Rows {
+	rows := sqlmock.NewRows(chirpColumns)
+	for _, chirp := range chirps {
+		var deletedAt driver.Value
+		if chirp.DeletedAt.Valid {
+			deletedAt = chirp.DeletedAt.Time
+		}
+		rows.AddRow(
+			chirp.ID.String(),
+			chirp.CreatedAt,
+			chirp.UpdatedAt,
+			chirp.Body,
+			chirp.UserID.String(),
+			nullUUIDValue(chirp.ReplyToID),
+			deletedAt,
+			nullUUIDValue(chirp.RechirpOfID),
+			nullUUIDValue(chirp.QuoteOfID),
+		)
+	}
+	return rows
+}
+
+// chirpCounts holds the rows returned by the count queries run for every
+// response containing chirps.
+type chirpCounts struct {
+	replies  *sqlmock.Rows
+	rechirps *sqlmock.Rows
+	likes    *sqlmock.Rows
+}
+
+// expectChirpCounts expects the three batched count queries, returning no
+// counts for any rows left nil.
+func expectChirpCounts(mock sqlmock.Sqlmock, counts chirpCounts) {
+	if counts.replies == nil {
+		counts.replies = sqlmock.NewRows([]string{"chirp_id", "reply_count"})
+	}
+	if counts.rechirps == nil {
+		counts.rechirps = sqlmock.NewRows([]string{"chirp_id", "rechirp_count"})
+	}
+	if counts.likes == nil {
+		counts.likes = sqlmock.NewRows([]string{"chirp_id", "like_count", "liked_by_viewer"})
+	}
+	mock.ExpectQuery(queryName("CountChirpReplies")).WillReturnRows(counts.replies)
+	mock.ExpectQuery(queryName("CountChirpRechirps")).WillReturnRows(counts.rechirps)
+	mock.ExpectQuery(queryName("CountChirpLikes")).WillReturnRows(counts.likes)
+}
+
+var userColumns = []string{
+	"id", "created_at", "updated_at", "email", "hashed_password", "is_chirpy_red",
+	"email_verified_at", "totp_secret", "totp_enabled_at", "totp_last_step", "role",
+}
+
+func mockUserRows(users ...database.User) *sqlmock.Rows {
+	rows := sqlmock.NewRows(userColumns)
+	for _, user := range users {
+		var emailVerifiedAt, totpSecret, totpEnabledAt, totpLastStep driver.Value
+		if user.EmailVerifiedAt.Valid {
+			emailVerifiedAt = user.EmailVerifiedAt.Time
+		}
+		if user.TotpSecret.Valid {
+			totpSecret = user.TotpSecret.String
+		}
+		if user.TotpEnabledAt.Valid {
+			totpEnabledAt = user.TotpEnabledAt.Time
+		}
+		if user.TotpLastStep.Valid {
+			totpLastStep = user.TotpLastStep.Int64
+		}
+		role := user.Role
+		if role == "" {
+			role = "user"
+		}
+		rows.AddRow(
+			user.ID.String(),
+			user.CreatedAt,
+			user.UpdatedAt,
+			user.Email,
+			user.HashedPassword,
+			user.IsChirpyRed,
+			emailVerifiedAt,
+			totpSecret,
+			totpEnabledAt,
+			totpLastStep,
+			role,
+		)
+	}
+	return rows
+}
+
+// testPasswordHasher keeps hashing fast in tests.
+var testPasswordHasher = auth.Argon2idHasher{
+	Memory:      64,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// useTestKeys gives cfg a signing key so tests can issue access tokens.
+func useTestKeys(t *testing.T, cfg *apiConfig) {
+	t.Helper()
+	keys, err := auth.NewKeySet(auth.NewHMACKey("test", "a secret only the tests know"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.jwtKeys = keys
+}
+
+// bearerToken issues an access token with every scope of role.
+func bearerToken(t *testing.T, cfg *apiConfig, userID uuid.UUID, role auth.Role) string {
+	t.Helper()
+	token, err := auth.MakeJWT(userID, role, role.Scopes(), cfg.jwtKeys, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// expectAccessTokenChecks expects the revocation lookups made the first
+// time an access token is validated.
+func expectAccessTokenChecks(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(queryName("GetUserTokenCutoff")).WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(queryName("IsAccessTokenRevoked")).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// profileJson is the public view of a user, so it leaves out their email.
+type profileJson struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	IsChirpyRed    bool      `json:"is_chirpy_red"`
+	FollowerCount  int64     `json:"follower_count"`
+	FollowingCount int64     `json:"following_count"`
+	// FollowedByMe is only set when the caller is logged in
+	FollowedByMe *bool `json:"followed_by_me,omitempty"`
+}
+
+type followJson struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+	FollowedAt  time.Time `json:"followed_at"`
+}
+
+type followsPageJson struct {
+	Users      []followJson `json:"users"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+// handlerFollowUser makes the caller follow a user. Following someone twice
+// has no further effect.
+func (cfg *apiConfig) handlerFollowUser(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Invalid user id provided",
+		})
+		return
+	}
+
+	if userID == claims.UserID {
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "You cannot follow yourself",
+		})
+		return
+	}
+
+	if _, err := cfg.db.GetUserByID(r.Context(), userID); err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "User does not exist",
+		})
+		return
+	}
+
+	err = cfg.db.FollowUser(r.Context(), database.FollowUserParams{
+		FollowerID: claims.UserID,
+		FolloweeID: userID,
+	})
+	// The user was deleted after they were looked up
+	if isForeignKeyViolation(err) {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "User does not exist",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to follow user %s for user %s: %v", userID, claims.UserID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerUnfollowUser stops the caller following a user. It succeeds
+// whether or not they were following them.
+func (cfg *apiConfig) handlerUnfollowUser(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Invalid user id provided",
+		})
+		return
+	}
+
+	err = cfg.db.UnfollowUser(r.Context(), database.UnfollowUserParams{
+		FollowerID: claims.UserID,
+		FolloweeID: userID,
+	})
+	if err != nil {
+		log.Printf("Failed to unfollow user %s for user %s: %v", userID, claims.UserID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerUserProfile returns the public profile of a user.
+func (cfg *apiConfig) handlerUserProfile(w http.ResponseWriter, r *http.Request, viewer uuid.NullUUID) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Invalid user id provided",
+		})
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to look up user %s: %v", userID, err)
+		}
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "User does not exist",
+		})
+		return
+	}
+
+	counts, err := cfg.db.GetFollowCounts(r.Context(), database.GetFollowCountsParams{
+		UserID:   userID,
+		ViewerID: viewer,
+	})
+	if err != nil {
+		log.Printf("Failed to count follows of user %s: %v", userID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	profile := profileJson{
+		ID:             user.ID,
+		CreatedAt:      user.CreatedAt,
+		IsChirpyRed:    user.IsChirpyRed,
+		FollowerCount:  counts.FollowerCount,
+		FollowingCount: counts.FollowingCount,
+	}
+	if viewer.Valid {
+		profile.FollowedByMe = &counts.FollowedByViewer
+	}
+	respondWithJson(w, http.StatusOK, profile)
+}
+
+// handlerFollowers lists the users following a user, most recent first.
+func (cfg *apiConfig) handlerFollowers(w http.ResponseWriter, r *http.Request, _ uuid.NullUUID) {
+	cfg.respondWithFollows(w, r, true)
+}
+
+// handlerFollowing lists the users a user follows, most recent first.
+func (cfg *apiConfig) handlerFollowing(w http.ResponseWriter, r *http.Request, _ uuid.NullUUID) {
+	cfg.respondWithFollows(w, r, false)
+}
+
+func (cfg *apiConfig) respondWithFollows(w http.ResponseWriter, r *http.Request, followers bool) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Invalid user id provided",
+		})
+		return
+	}
+
+	limit, err := parseLimit(r)
+	if err != nil {
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	cursorCreatedAt := sql.NullTime{}
+	cursorID := uuid.NullUUID{}
+	if cursorStr := r.URL.Query().Get("cursor"); cursorStr != "" {
+		cursor, err := decodeCursor(cursorStr)
+		if err != nil {
+			respondWithJson(w, http.StatusBadRequest, errorResponse{
+				Error: "Invalid cursor provided",
+			})
+			return
+		}
+		cursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		cursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+
+	if _, err := cfg.db.GetUserByID(r.Context(), userID); err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "User does not exist",
+		})
+		return
+	}
+
+	// Fetch one extra row to find out whether another page follows
+	var rows []database.ListFollowersRow
+	if followers {
+		rows, err = cfg.db.ListFollowers(r.Context(), database.ListFollowersParams{
+			UserID:          userID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			Limit:           int32(limit + 1),
+		})
+	} else {
+		var following []database.ListFollowingRow
+		following, err = cfg.db.ListFollowing(r.Context(), database.ListFollowingParams{
+			UserID:          userID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			Limit:           int32(limit + 1),
+		})
+		for _, row := range following {
+			rows = append(rows, database.ListFollowersRow(row))
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to list follows of user %s: %v", userID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	page := followsPageJson{Users: []followJson{}}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		last := rows[len(rows)-1]
+		page.NextCursor = encodeCursor(pageCursor{CreatedAt: last.FollowedAt, ID: last.ID})
+	}
+	for _, row := range rows {
+		page.Users = append(page.Users, followJson{
+			ID:          row.ID,
+			CreatedAt:   row.CreatedAt,
+			IsChirpyRed: row.IsChirpyRed,
+			FollowedAt:  row.FollowedAt,
+		})
+	}
+	respondWithJson(w, http.StatusOK, page)
+}
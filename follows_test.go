@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestFollowSelfRejected(t *testing.T) {
+	cfg := &apiConfig{}
+	userID := uuid.New()
+	req := httptest.NewRequest(http.MethodPut, "/api/users/"+userID.String()+"/follow", nil)
+	req.SetPathValue("userID", userID.String())
+	rec := httptest.NewRecorder()
+
+	cfg.handlerFollowUser(rec, req, auth.AccessClaims{UserID: userID})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestFollowUserTwice(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	followerID := uuid.New()
+	followee := database.User{ID: uuid.New(), Email: "jesse@example.com"}
+
+	// A second follow is absorbed by the conflict clause rather than failing
+	for range 2 {
+		mock.ExpectQuery(queryName("GetUserByID")).WillReturnRows(mockUserRows(followee))
+		mock.ExpectExec(queryName("FollowUser")+`(?s).*ON CONFLICT \(follower_id, followee_id\) DO NOTHING`).
+			WithArgs(followerID.String(), followee.ID.String()).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+
+	for i := range 2 {
+		req := httptest.NewRequest(http.MethodPut, "/api/users/"+followee.ID.String()+"/follow", nil)
+		req.SetPathValue("userID", followee.ID.String())
+		rec := httptest.NewRecorder()
+		cfg.handlerFollowUser(rec, req, auth.AccessClaims{UserID: followerID})
+
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("follow %d: status = %d, want %d: %s", i+1, rec.Code, http.StatusNoContent, rec.Body)
+		}
+	}
+}
+
+func TestUserProfileFollowCounts(t *testing.T) {
+	user := database.User{ID: uuid.New(), Email: "walt@example.com"}
+	tests := []struct {
+		name   string
+		viewer uuid.NullUUID
+		want   string
+	}{
+		{
+			name: "Anonymous viewer",
+			want: "",
+		},
+		{
+			name:   "Logged in viewer",
+			viewer: uuid.NullUUID{UUID: uuid.New(), Valid: true},
+			want:   "true",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, mock := newMockConfig(t)
+			mock.ExpectQuery(queryName("GetUserByID")).WillReturnRows(mockUserRows(user))
+			mock.ExpectQuery(queryName("GetFollowCounts")).
+				WithArgs(user.ID.String(), nullUUIDValue(test.viewer)).
+				WillReturnRows(sqlmock.NewRows([]string{"follower_count", "following_count", "followed_by_viewer"}).
+					AddRow(2, 1, test.viewer.Valid))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/users/"+user.ID.String(), nil)
+			req.SetPathValue("userID", user.ID.String())
+			rec := httptest.NewRecorder()
+			cfg.handlerUserProfile(rec, req, test.viewer)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+			var got map[string]json.RawMessage
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if string(got["followed_by_me"]) != test.want {
+				t.Errorf("followed_by_me = %s, want %q", got["followed_by_me"], test.want)
+			}
+			if string(got["follower_count"]) != "2" || string(got["following_count"]) != "1" {
+				t.Errorf("counts = %s/%s, want 2/1", got["follower_count"], got["following_count"])
+			}
+			if _, ok := got["email"]; ok {
+				t.Error("public profile includes the email address")
+			}
+		})
+	}
+}
+
+func TestFollowsPaging(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	user := database.User{ID: uuid.New(), Email: "walt@example.com"}
+	// Accounts older than the follows, so paging by account age would differ
+	follows := []followJson{
+		{ID: uuid.New(), CreatedAt: now.Add(-72 * time.Hour), FollowedAt: now.Add(-time.Minute)},
+		{ID: uuid.New(), CreatedAt: now.Add(-24 * time.Hour), FollowedAt: now.Add(-2 * time.Minute)},
+		{ID: uuid.New(), CreatedAt: now.Add(-48 * time.Hour), FollowedAt: now.Add(-3 * time.Minute)},
+	}
+
+	for _, list := range []string{"followers", "following"} {
+		t.Run(list, func(t *testing.T) {
+			cfg, mock := newMockConfig(t)
+			rows := sqlmock.NewRows([]string{"id", "created_at", "is_chirpy_red", "followed_at"})
+			for _, follow := range follows {
+				rows.AddRow(follow.ID.String(), follow.CreatedAt, false, follow.FollowedAt)
+			}
+			query := "ListFollowers"
+			handler := cfg.handlerFollowers
+			if list == "following" {
+				query = "ListFollowing"
+				handler = cfg.handlerFollowing
+			}
+
+			cursor := pageCursor{CreatedAt: now, ID: uuid.New()}
+			mock.ExpectQuery(queryName("GetUserByID")).WillReturnRows(mockUserRows(user))
+			// One extra row shows there is a next page
+			mock.ExpectQuery(queryName(query)).
+				WithArgs(user.ID.String(), cursor.CreatedAt, cursor.ID.String(), 3).
+				WillReturnRows(rows)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/users/"+user.ID.String()+"/"+list+"?limit=2&cursor="+encodeCursor(cursor), nil)
+			req.SetPathValue("userID", user.ID.String())
+			rec := httptest.NewRecorder()
+			handler(rec, req, uuid.NullUUID{})
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+			var got followsPageJson
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Users) != 2 || got.Users[0].ID != follows[0].ID || got.Users[1].ID != follows[1].ID {
+				t.Errorf("users = %+v, want the two most recent follows", got.Users)
+			}
+			next, err := decodeCursor(got.NextCursor)
+			if err != nil {
+				t.Fatalf("next_cursor %q: %v", got.NextCursor, err)
+			}
+			if next.ID != follows[1].ID || !next.CreatedAt.Equal(follows[1].FollowedAt) {
+				t.Errorf("next_cursor = %+v, want the follow of the last user on the page", next)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -11,65 +12,129 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type TokenType string
 
 const (
 	TokenTypeAccess TokenType = "chirpy"
+	// TokenTypeMFA marks a short lived token proving the password step of a
+	// two-factor login succeeded. It is not accepted as an access token.
+	TokenTypeMFA TokenType = "chirpy-mfa"
 )
 
-func HashPassword(password string) (string, error) {
-	byteHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", fmt.Errorf("Failed to hash password: %v", err)
+// MakeJWT issues an access token for a user with the given role, granting
+// scopes.
+func MakeJWT(userID uuid.UUID, role Role, scopes []string, keys *KeySet, expiresIn time.Duration) (string, error) {
+	return makeToken(userID, keys, expiresIn, TokenTypeAccess, role, scopes)
+}
+
+func MakeMFAToken(userID uuid.UUID, keys *KeySet, expiresIn time.Duration) (string, error) {
+	return makeToken(userID, keys, expiresIn, TokenTypeMFA, "", nil)
+}
+
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Role  Role    `json:"role,omitempty"`
+	Scope *string `json:"scope,omitempty"`
+}
+
+func makeToken(userID uuid.UUID, keys *KeySet, expiresIn time.Duration, tokenType TokenType, role Role, scopes []string) (string, error) {
+	now := time.Now().UTC()
+	claims := tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    string(tokenType),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+			Subject:   userID.String(),
+			ID:        uuid.NewString(),
+		},
+		Role: role,
+	}
+	if tokenType == TokenTypeAccess {
+		scope := JoinScopes(scopes)
+		claims.Scope = &scope
 	}
-	return string(byteHash), nil
+	return keys.sign(claims)
 }
 
-func CheckPasswordHash(password, hash string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+// AccessClaims are the verified claims of an access token.
+type AccessClaims struct {
+	UserID    uuid.UUID
+	TokenID   string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	Role      Role
+	Scopes    []string
+}
+
+func ValidateJWT(tokenString string, keys *KeySet) (uuid.UUID, error) {
+	claims, err := ParseAccessToken(tokenString, keys)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return claims.UserID, nil
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject:   userID.String(),
-	})
+// ParseAccessToken validates an access token and returns its claims. Checking
+// whether the token has since been revoked is left to the caller.
+func ParseAccessToken(tokenString string, keys *KeySet) (AccessClaims, error) {
+	return validateToken(tokenString, keys, TokenTypeAccess)
+}
 
-	return token.SignedString([]byte(tokenSecret))
+func ValidateMFAToken(tokenString string, keys *KeySet) (uuid.UUID, error) {
+	claims, err := validateToken(tokenString, keys, TokenTypeMFA)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return claims.UserID, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	var registeredClaims jwt.RegisteredClaims
-	token, err := jwt.ParseWithClaims(tokenString, &registeredClaims, func(t *jwt.Token) (any, error) {
-		return []byte(tokenSecret), nil
-	})
+func validateToken(tokenString string, keys *KeySet, tokenType TokenType) (AccessClaims, error) {
+	var parsedClaims tokenClaims
+	token, err := jwt.ParseWithClaims(tokenString, &parsedClaims, keys.keyFunc)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("Failed to validate token: %w", err)
+		return AccessClaims{}, fmt.Errorf("Failed to validate token: %w", err)
 	}
 	userIdStr, err := token.Claims.GetSubject()
 	if err != nil {
-		return uuid.UUID{}, err
+		return AccessClaims{}, err
 	}
 	issuer, err := token.Claims.GetIssuer()
 	if err != nil {
-		return uuid.Nil, err
+		return AccessClaims{}, err
 	}
 
-	if issuer != "chirpy" {
-		return uuid.Nil, errors.New("invalid issuer")
+	if issuer != string(tokenType) {
+		return AccessClaims{}, errors.New("invalid issuer")
 	}
 
 	id, err := uuid.Parse(userIdStr)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("invalid user ID: %w", err)
+		return AccessClaims{}, fmt.Errorf("invalid user ID: %w", err)
 	}
 
-	return id, nil
+	claims := AccessClaims{
+		UserID:  id,
+		TokenID: parsedClaims.ID,
+		Role:    parsedClaims.Role,
+	}
+	if parsedClaims.IssuedAt != nil {
+		claims.IssuedAt = parsedClaims.IssuedAt.Time
+	}
+	if parsedClaims.ExpiresAt != nil {
+		claims.ExpiresAt = parsedClaims.ExpiresAt.Time
+	}
+	// Tokens issued before roles existed carry neither claim
+	if claims.Role == "" {
+		claims.Role = RoleUser
+	}
+	if parsedClaims.Scope != nil {
+		claims.Scopes = SplitScopes(*parsedClaims.Scope)
+	} else {
+		claims.Scopes = claims.Role.Scopes()
+	}
+	return claims, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -85,7 +150,27 @@ func GetBearerToken(headers http.Header) (string, error) {
 	return authFeilds[1], nil
 }
 
+// GetAPIKey extracts the key from an "Authorization: ApiKey <key>" header.
+func GetAPIKey(headers http.Header) (string, error) {
+	authHeader := headers.Get("Authorization")
+	if authHeader == "" {
+		return "", errors.New("no authorization header")
+	}
+
+	authFeilds := strings.Fields(authHeader)
+	if len(authFeilds) < 2 || authFeilds[0] != "ApiKey" {
+		return "", errors.New("invalid authorization header")
+	}
+	return authFeilds[1], nil
+}
+
 func MakeRefreshToken() (string, error) {
+	return MakeOpaqueToken()
+}
+
+// MakeOpaqueToken returns a random 256-bit hex token, used for refresh tokens
+// and single-use links sent by email.
+func MakeOpaqueToken() (string, error) {
 	tokenByte := make([]byte, 32)
 	_, err := rand.Read(tokenByte)
 	if err != nil {
@@ -93,3 +178,23 @@ func MakeRefreshToken() (string, error) {
 	}
 	return hex.EncodeToString(tokenByte), nil
 }
+
+// APIKeyPrefix starts every personal API key so leaked keys are easy to
+// recognise.
+const APIKeyPrefix = "chirpy_"
+
+// MakeAPIKey returns a new random personal API key.
+func MakeAPIKey() (string, error) {
+	token, err := MakeOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	return APIKeyPrefix + token, nil
+}
+
+// HashToken returns the hex encoded SHA-256 digest of an opaque token. Only
+// the digest is persisted so a database leak does not expose usable tokens.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,8 +1,10 @@
 package auth
 
 import (
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"net/http"
+	"slices"
 	"testing"
 	"time"
 )
@@ -61,48 +63,58 @@ func TestCheckPasswordHash(t *testing.T) {
 
 func TestValidateJWT(t *testing.T) {
 	userId := uuid.New()
-	validToken, _ := MakeJWT(userId, "secret", time.Hour)
-	expiredToken, _ := MakeJWT(userId, "secret", -time.Hour)
+	keys, _ := NewKeySet(NewHMACKey("default", "secret"))
+	wrongKeys, _ := NewKeySet(NewHMACKey("default", "wrong"))
+	validToken, _ := MakeJWT(userId, RoleUser, RoleUser.Scopes(), keys, time.Hour)
+	expiredToken, _ := MakeJWT(userId, RoleUser, RoleUser.Scopes(), keys, -time.Hour)
+	mfaToken, _ := MakeMFAToken(userId, keys, time.Hour)
 
 	tests := []struct {
 		name        string
 		tokenString string
-		tokenSecret string
+		keys        *KeySet
 		wantUserId  uuid.UUID
 		wantErr     bool
 	}{
 		{
 			name:        "Valid Token",
 			tokenString: validToken,
-			tokenSecret: "secret",
+			keys:        keys,
 			wantUserId:  userId,
 			wantErr:     false,
 		},
 		{
 			name:        "Invalid Token",
 			tokenString: "Random token",
-			tokenSecret: "secret",
+			keys:        keys,
 			wantUserId:  uuid.Nil,
 			wantErr:     true,
 		},
 		{
 			name:        "Wrong secret",
 			tokenString: validToken,
-			tokenSecret: "wrong",
+			keys:        wrongKeys,
 			wantUserId:  uuid.Nil,
 			wantErr:     true,
 		},
 		{
 			name:        "Expired Token",
 			tokenString: expiredToken,
-			tokenSecret: "secret",
+			keys:        keys,
+			wantUserId:  uuid.Nil,
+			wantErr:     true,
+		},
+		{
+			name:        "MFA Token",
+			tokenString: mfaToken,
+			keys:        keys,
 			wantUserId:  uuid.Nil,
 			wantErr:     true,
 		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			gotUserId, err := ValidateJWT(test.tokenString, test.tokenSecret)
+			gotUserId, err := ValidateJWT(test.tokenString, test.keys)
 			if (err != nil) != test.wantErr {
 				t.Errorf("ValidateJWT(), error =  %v, wantErr %v", err, test.wantErr)
 				return
@@ -114,6 +126,95 @@ func TestValidateJWT(t *testing.T) {
 	}
 }
 
+func TestParseAccessToken(t *testing.T) {
+	userID := uuid.New()
+	keys, _ := NewKeySet(NewHMACKey("default", "secret"))
+	first, _ := MakeJWT(userID, RoleUser, RoleUser.Scopes(), keys, time.Hour)
+	second, _ := MakeJWT(userID, RoleUser, RoleUser.Scopes(), keys, time.Hour)
+
+	firstClaims, err := ParseAccessToken(first, keys)
+	if err != nil {
+		t.Fatalf("ParseAccessToken() error = %v", err)
+	}
+	secondClaims, _ := ParseAccessToken(second, keys)
+
+	if firstClaims.UserID != userID {
+		t.Errorf("ParseAccessToken() UserID = %v, want %v", firstClaims.UserID, userID)
+	}
+	if firstClaims.TokenID == "" || firstClaims.TokenID == secondClaims.TokenID {
+		t.Errorf("ParseAccessToken() token ids %q and %q should be unique", firstClaims.TokenID, secondClaims.TokenID)
+	}
+	if time.Since(firstClaims.IssuedAt) > time.Minute || firstClaims.ExpiresAt.Sub(firstClaims.IssuedAt) != time.Hour {
+		t.Errorf("ParseAccessToken() iat = %v, exp = %v", firstClaims.IssuedAt, firstClaims.ExpiresAt)
+	}
+}
+
+func TestAccessTokenRoleAndScopes(t *testing.T) {
+	userID := uuid.New()
+	keys, _ := NewKeySet(NewHMACKey("default", "secret"))
+
+	tests := []struct {
+		name       string
+		role       Role
+		scopes     []string
+		wantScopes []string
+	}{
+		{
+			name:       "User",
+			role:       RoleUser,
+			scopes:     RoleUser.Scopes(),
+			wantScopes: []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeUsersRead, ScopeUsersWrite, ScopeAccount},
+		},
+		{
+			name:       "Admin",
+			role:       RoleAdmin,
+			scopes:     RoleAdmin.Scopes(),
+			wantScopes: RoleAdmin.Scopes(),
+		},
+		{
+			name:       "Narrowed scopes",
+			role:       RoleModerator,
+			scopes:     []string{ScopeChirpsRead},
+			wantScopes: []string{ScopeChirpsRead},
+		},
+		{
+			name:       "No scopes",
+			role:       RoleAdmin,
+			scopes:     nil,
+			wantScopes: nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token, _ := MakeJWT(userID, test.role, test.scopes, keys, time.Hour)
+			claims, err := ParseAccessToken(token, keys)
+			if err != nil {
+				t.Fatalf("ParseAccessToken() error = %v", err)
+			}
+			if claims.Role != test.role {
+				t.Errorf("ParseAccessToken() Role = %v, want %v", claims.Role, test.role)
+			}
+			if !slices.Equal(claims.Scopes, test.wantScopes) {
+				t.Errorf("ParseAccessToken() Scopes = %v, want %v", claims.Scopes, test.wantScopes)
+			}
+		})
+	}
+
+	// Tokens issued before roles were introduced get the user role's scopes
+	legacy, _ := keys.sign(jwt.RegisteredClaims{
+		Issuer:    string(TokenTypeAccess),
+		Subject:   userID.String(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	claims, err := ParseAccessToken(legacy, keys)
+	if err != nil {
+		t.Fatalf("ParseAccessToken() legacy error = %v", err)
+	}
+	if claims.Role != RoleUser || !claims.HasScope(ScopeChirpsWrite) || claims.HasScope(ScopeUsersAdmin) {
+		t.Errorf("ParseAccessToken() legacy claims = %+v", claims)
+	}
+}
+
 func TestBearerToken(t *testing.T) {
 
 	testToken := "testtoken"
@@ -163,3 +264,68 @@ func TestBearerToken(t *testing.T) {
 		})
 	}
 }
+
+func TestGetAPIKey(t *testing.T) {
+	validHeader := http.Header{}
+	validHeader.Set("Authorization", "ApiKey testkey")
+	bearerHeader := http.Header{}
+	bearerHeader.Set("Authorization", "Bearer testkey")
+
+	tests := []struct {
+		name     string
+		header   http.Header
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "Valid ApiKey header",
+			header:   validHeader,
+			expected: "testkey",
+			wantErr:  false,
+		},
+		{
+			name:     "No Authorization header",
+			header:   http.Header{},
+			expected: "",
+			wantErr:  true,
+		},
+		{
+			name:     "Bearer scheme",
+			header:   bearerHeader,
+			expected: "",
+			wantErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, err := GetAPIKey(test.header)
+			if (err != nil) != test.wantErr {
+				t.Errorf("GetAPIKey(), error = %v, wantErr = %v", err, test.wantErr)
+				return
+			}
+			if key != test.expected {
+				t.Errorf("GetAPIKey(), key = %v want = %v", key, test.expected)
+			}
+		})
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		t.Fatalf("MakeRefreshToken() error = %v", err)
+	}
+	hash := HashToken(token)
+	if hash == token {
+		t.Errorf("HashToken() returned the token unchanged")
+	}
+	if HashToken(token) != hash {
+		t.Errorf("HashToken() is not deterministic")
+	}
+	// Matches PostgreSQL's encode(sha256(...), 'hex') used by the migration
+	want := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	if got := HashToken("test"); got != want {
+		t.Errorf("HashToken(\"test\") = %s, want %s", got, want)
+	}
+}
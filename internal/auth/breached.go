@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// BreachedPasswordSource looks up breached passwords in the style of the Pwned
+// Passwords range API: given the first five hex characters of a password's
+// SHA-1 digest it returns the remaining 35 characters of every breached
+// password sharing that prefix, so the password itself never leaves the
+// caller.
+type BreachedPasswordSource interface {
+	Range(ctx context.Context, prefix string) ([]string, error)
+}
+
+const breachedPrefixLength = 5
+
+// IsBreachedPassword reports whether password appears in src.
+func IsBreachedPassword(ctx context.Context, src BreachedPasswordSource, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+	suffixes, err := src.Range(ctx, digest[:breachedPrefixLength])
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(suffixes, digest[breachedPrefixLength:]), nil
+}
+
+//go:embed breached_passwords.txt
+var bundledBreachedPasswords string
+
+// BreachedPasswordList is an in-memory BreachedPasswordSource.
+type BreachedPasswordList struct {
+	ranges map[string][]string
+}
+
+// BundledBreachedPasswords returns a small list of the most common breached
+// passwords that ships with the server.
+func BundledBreachedPasswords() *BreachedPasswordList {
+	list, err := LoadBreachedPasswordList(strings.NewReader(bundledBreachedPasswords))
+	if err != nil {
+		panic(err)
+	}
+	return list
+}
+
+// LoadBreachedPasswordList reads upper or lower case hex SHA-1 digests, one
+// per line, each optionally followed by ":<count>" as in the Pwned Passwords
+// downloads.
+func LoadBreachedPasswordList(r io.Reader) (*BreachedPasswordList, error) {
+	list := &BreachedPasswordList{ranges: map[string][]string{}}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		digest, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if digest == "" {
+			continue
+		}
+		if _, err := hex.DecodeString(digest); err != nil || len(digest) != 2*sha1.Size {
+			return nil, fmt.Errorf("line %d: invalid SHA-1 digest", line)
+		}
+		digest = strings.ToUpper(digest)
+		prefix := digest[:breachedPrefixLength]
+		list.ranges[prefix] = append(list.ranges[prefix], digest[breachedPrefixLength:])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (l *BreachedPasswordList) Range(ctx context.Context, prefix string) ([]string, error) {
+	return l.ranges[strings.ToUpper(prefix)], nil
+}
+
+// BreachedPasswordDir is a BreachedPasswordSource backed by a directory
+// holding one file per prefix, named after the prefix and containing the
+// range API response for it ("<suffix>:<count>" lines). Missing files are
+// treated as empty ranges.
+type BreachedPasswordDir struct {
+	Dir string
+}
+
+var errInvalidBreachedPrefix = errors.New("invalid breached password prefix")
+
+func (d BreachedPasswordDir) Range(ctx context.Context, prefix string) ([]string, error) {
+	prefix = strings.ToUpper(prefix)
+	if _, err := hex.DecodeString(prefix + "0"); err != nil || len(prefix) != breachedPrefixLength {
+		return nil, errInvalidBreachedPrefix
+	}
+
+	file, err := os.Open(filepath.Join(d.Dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	suffixes := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		suffix, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if suffix != "" {
+			suffixes = append(suffixes, strings.ToUpper(suffix))
+		}
+	}
+	return suffixes, scanner.Err()
+}
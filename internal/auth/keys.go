@@ -0,0 +1,292 @@
+package auth
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is a JWT key identified by the kid header of the tokens it signs.
+// Keys loaded from a public key file can only verify tokens.
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	private any
+	public  any
+}
+
+// NewHMACKey creates a symmetric HS256 key from a shared secret.
+func NewHMACKey(id, secret string) *SigningKey {
+	return &SigningKey{
+		ID:      id,
+		Method:  jwt.SigningMethodHS256,
+		private: []byte(secret),
+		public:  []byte(secret),
+	}
+}
+
+// NewEd25519Key wraps an Ed25519 private key for EdDSA signing.
+func NewEd25519Key(id string, key ed25519.PrivateKey) *SigningKey {
+	return &SigningKey{
+		ID:      id,
+		Method:  jwt.SigningMethodEdDSA,
+		private: key,
+		public:  key.Public(),
+	}
+}
+
+// NewRSAKey wraps an RSA private key for RS256 signing.
+func NewRSAKey(id string, key *rsa.PrivateKey) *SigningKey {
+	return &SigningKey{
+		ID:      id,
+		Method:  jwt.SigningMethodRS256,
+		private: key,
+		public:  &key.PublicKey,
+	}
+}
+
+// LoadPrivateKeyFile reads a PEM encoded Ed25519 or RSA private key.
+func LoadPrivateKeyFile(id, path string) (*SigningKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed any
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse private key %s: %w", path, err)
+	}
+
+	switch key := parsed.(type) {
+	case ed25519.PrivateKey:
+		return NewEd25519Key(id, key), nil
+	case *rsa.PrivateKey:
+		return NewRSAKey(id, key), nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T in %s", parsed, path)
+	}
+}
+
+// LoadPublicKeyFile reads a PEM encoded Ed25519 or RSA public key which can
+// only be used to verify tokens, e.g. a retired signing key.
+func LoadPublicKeyFile(id, path string) (*SigningKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse public key %s: %w", path, err)
+	}
+
+	switch key := parsed.(type) {
+	case ed25519.PublicKey:
+		return &SigningKey{ID: id, Method: jwt.SigningMethodEdDSA, public: key}, nil
+	case *rsa.PublicKey:
+		return &SigningKey{ID: id, Method: jwt.SigningMethodRS256, public: key}, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T in %s", parsed, path)
+	}
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read key file: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+	return block, nil
+}
+
+// PublicKey returns the key used to verify signatures.
+func (k *SigningKey) PublicKey() any {
+	return k.public
+}
+
+// KeySet holds the key used to sign new tokens along with every key that is
+// still accepted when verifying them, so signing keys can be rotated.
+type KeySet struct {
+	signing *SigningKey
+	keys    map[string]*SigningKey
+}
+
+// NewKeySet creates a key set signing with the given key and additionally
+// accepting tokens signed by any of the verification keys.
+func NewKeySet(signing *SigningKey, verification ...*SigningKey) (*KeySet, error) {
+	if signing == nil || signing.private == nil {
+		return nil, errors.New("signing key must include a private key")
+	}
+	ks := &KeySet{
+		signing: signing,
+		keys:    map[string]*SigningKey{signing.ID: signing},
+	}
+	for _, key := range verification {
+		if _, exists := ks.keys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		ks.keys[key.ID] = key
+	}
+	return ks, nil
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	token.Header["kid"] = ks.signing.ID
+	return token.SignedString(ks.signing.private)
+}
+
+func (ks *KeySet) keyFunc(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok && kid == "" && ks.signing.Method == jwt.SigningMethodHS256 {
+		// Tokens issued before key ids were introduced
+		key, ok = ks.signing, true
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if t.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for key %q", t.Method.Alg(), kid)
+	}
+	return key.public, nil
+}
+
+// JWK is a JSON Web Key as described in RFC 7517.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public halves of every asymmetric key in the set. Shared
+// HMAC secrets are never published.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		switch pub := key.public.(type) {
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "OKP",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Method.Alg(),
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(pub),
+			})
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "RSA",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Method.Alg(),
+				N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		}
+	}
+	slices.SortFunc(set.Keys, func(a, b JWK) int {
+		return strings.Compare(a.KeyID, b.KeyID)
+	})
+	return set
+}
+
+// VerificationKey converts a public JWK into a key that can only verify
+// tokens. RSA, Ed25519 and NIST P-256/P-384 keys are supported.
+func (k JWK) VerificationKey() (*SigningKey, error) {
+	var method jwt.SigningMethod
+	var public any
+	switch k.KeyType {
+	case "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("malformed RSA key %q", k.KeyID)
+		}
+		public = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		switch k.Algorithm {
+		case "", "RS256":
+			method = jwt.SigningMethodRS256
+		case "RS384":
+			method = jwt.SigningMethodRS384
+		case "RS512":
+			method = jwt.SigningMethodRS512
+		}
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if k.Curve != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("malformed OKP key %q", k.KeyID)
+		}
+		public = ed25519.PublicKey(x)
+		method = jwt.SigningMethodEdDSA
+	case "EC":
+		var ecdhCurve ecdh.Curve
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			ecdhCurve, curve, method = ecdh.P256(), elliptic.P256(), jwt.SigningMethodES256
+		case "P-384":
+			ecdhCurve, curve, method = ecdh.P384(), elliptic.P384(), jwt.SigningMethodES384
+		default:
+			return nil, fmt.Errorf("unsupported curve %q for key %q", k.Curve, k.KeyID)
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		size := (curve.Params().BitSize + 7) / 8
+		if errX != nil || errY != nil || len(x) != size || len(y) != size {
+			return nil, fmt.Errorf("malformed EC key %q", k.KeyID)
+		}
+		// Rejects points that aren't on the curve
+		if _, err := ecdhCurve.NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, fmt.Errorf("malformed EC key %q: %w", k.KeyID, err)
+		}
+		public = &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %q for key %q", k.KeyType, k.KeyID)
+	}
+
+	if method == nil || (k.Algorithm != "" && k.Algorithm != method.Alg()) {
+		return nil, fmt.Errorf("unsupported algorithm %q for key %q", k.Algorithm, k.KeyID)
+	}
+	return &SigningKey{ID: k.KeyID, Method: method, public: public}, nil
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "key.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	return path
+}
+
+func TestLoadKeyFiles(t *testing.T) {
+	_, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	rsaPriv, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	edDER, _ := x509.MarshalPKCS8PrivateKey(edPriv)
+	rsaDER, _ := x509.MarshalPKCS8PrivateKey(rsaPriv)
+	edPubDER, _ := x509.MarshalPKIXPublicKey(edPriv.Public())
+
+	tests := []struct {
+		name    string
+		load    func() (*SigningKey, error)
+		wantAlg string
+	}{
+		{
+			name: "Ed25519 private key",
+			load: func() (*SigningKey, error) {
+				return LoadPrivateKeyFile("ed", writePEM(t, "PRIVATE KEY", edDER))
+			},
+			wantAlg: "EdDSA",
+		},
+		{
+			name: "RSA PKCS8 private key",
+			load: func() (*SigningKey, error) {
+				return LoadPrivateKeyFile("rsa", writePEM(t, "PRIVATE KEY", rsaDER))
+			},
+			wantAlg: "RS256",
+		},
+		{
+			name: "RSA PKCS1 private key",
+			load: func() (*SigningKey, error) {
+				return LoadPrivateKeyFile("rsa1", writePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaPriv)))
+			},
+			wantAlg: "RS256",
+		},
+		{
+			name: "Ed25519 public key",
+			load: func() (*SigningKey, error) {
+				return LoadPublicKeyFile("edpub", writePEM(t, "PUBLIC KEY", edPubDER))
+			},
+			wantAlg: "EdDSA",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, err := test.load()
+			if err != nil {
+				t.Fatalf("load error = %v", err)
+			}
+			if key.Method.Alg() != test.wantAlg {
+				t.Errorf("alg = %s, want %s", key.Method.Alg(), test.wantAlg)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	userID := uuid.New()
+	_, oldPriv, _ := ed25519.GenerateKey(rand.Reader)
+	newPriv, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	oldKeys, _ := NewKeySet(NewEd25519Key("2024", oldPriv))
+	oldToken, _ := MakeJWT(userID, RoleUser, RoleUser.Scopes(), oldKeys, time.Hour)
+
+	retired := &SigningKey{ID: "2024", Method: oldKeys.signing.Method, public: oldPriv.Public()}
+	rotated, err := NewKeySet(NewRSAKey("2025", newPriv), retired)
+	if err != nil {
+		t.Fatalf("NewKeySet() error = %v", err)
+	}
+	newToken, _ := MakeJWT(userID, RoleUser, RoleUser.Scopes(), rotated, time.Hour)
+
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		got, err := ValidateJWT(token, rotated)
+		if err != nil {
+			t.Errorf("ValidateJWT(%s token) error = %v", name, err)
+		}
+		if got != userID {
+			t.Errorf("ValidateJWT(%s token) = %v, want %v", name, got, userID)
+		}
+	}
+
+	if _, err := ValidateJWT(newToken, oldKeys); err == nil {
+		t.Errorf("ValidateJWT() accepted a token with an unknown key id")
+	}
+
+	jwks := rotated.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].KeyID != "2024" || jwks.Keys[1].KeyID != "2025" {
+		t.Fatalf("JWKS() = %+v, want keys 2024 and 2025", jwks)
+	}
+	if jwks.Keys[0].KeyType != "OKP" || jwks.Keys[1].KeyType != "RSA" || jwks.Keys[1].E != "AQAB" {
+		t.Errorf("JWKS() = %+v, unexpected key parameters", jwks)
+	}
+}
+
+func TestAlgorithmConfusion(t *testing.T) {
+	_, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	edKeys, _ := NewKeySet(NewEd25519Key("main", edPriv))
+
+	// An HS256 token using the same kid must not verify against the public key
+	hmacKeys, _ := NewKeySet(NewHMACKey("main", string(edPriv.Public().(ed25519.PublicKey))))
+	forged, _ := MakeJWT(uuid.New(), RoleUser, RoleUser.Scopes(), hmacKeys, time.Hour)
+	if _, err := ValidateJWT(forged, edKeys); err == nil {
+		t.Errorf("ValidateJWT() accepted an HS256 token for an EdDSA key")
+	}
+
+	if len(hmacKeys.JWKS().Keys) != 0 {
+		t.Errorf("JWKS() published an HMAC secret")
+	}
+}
+
+func TestJWKVerificationKey(t *testing.T) {
+	_, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	rsaPriv, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecPriv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	// Keys published by our own JWKS endpoint round trip
+	keys, _ := NewKeySet(NewEd25519Key("ed", edPriv), NewRSAKey("rsa", rsaPriv))
+	for _, jwk := range keys.JWKS().Keys {
+		key, err := jwk.VerificationKey()
+		if err != nil {
+			t.Fatalf("VerificationKey(%s) error = %v", jwk.KeyID, err)
+		}
+		if key.Method.Alg() != jwk.Algorithm {
+			t.Errorf("VerificationKey(%s) alg = %s, want %s", jwk.KeyID, key.Method.Alg(), jwk.Algorithm)
+		}
+	}
+
+	ecJWK := JWK{
+		KeyType: "EC",
+		KeyID:   "ec",
+		Curve:   "P-256",
+		X:       base64.RawURLEncoding.EncodeToString(ecPriv.X.FillBytes(make([]byte, 32))),
+		Y:       base64.RawURLEncoding.EncodeToString(ecPriv.Y.FillBytes(make([]byte, 32))),
+	}
+	key, err := ecJWK.VerificationKey()
+	if err != nil || key.Method.Alg() != "ES256" {
+		t.Fatalf("VerificationKey(EC) = %v, %v", key, err)
+	}
+	if !key.PublicKey().(*ecdsa.PublicKey).Equal(&ecPriv.PublicKey) {
+		t.Errorf("VerificationKey(EC) returned a different key")
+	}
+
+	invalid := []JWK{
+		{KeyType: "oct", KeyID: "hmac"},
+		{KeyType: "RSA", KeyID: "rsa", Algorithm: "HS256", N: "AQAB", E: "AQAB"},
+		{KeyType: "OKP", KeyID: "ed", Curve: "Ed25519", X: "AQAB"},
+		{KeyType: "EC", KeyID: "off-curve", Curve: "P-256", X: ecJWK.X, Y: ecJWK.X},
+	}
+	for _, jwk := range invalid {
+		if _, err := jwk.VerificationKey(); err == nil {
+			t.Errorf("VerificationKey(%s) accepted an invalid key", jwk.KeyID)
+		}
+	}
+}
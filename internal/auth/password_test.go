@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Cheap parameters keep the tests fast
+var testArgon2idHasher = Argon2idHasher{
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func TestPasswordHashers(t *testing.T) {
+	hashers := map[string]PasswordHasher{
+		"argon2id": testArgon2idHasher,
+		"bcrypt":   BcryptHasher{Cost: bcrypt.MinCost},
+	}
+	for name, hasher := range hashers {
+		t.Run(name, func(t *testing.T) {
+			hash, err := hasher.Hash("CorrectPassword1!")
+			if err != nil {
+				t.Fatalf("Hash() error = %v", err)
+			}
+			if err := CheckPasswordHash("CorrectPassword1!", hash); err != nil {
+				t.Errorf("CheckPasswordHash() correct password error = %v", err)
+			}
+			if err := CheckPasswordHash("WrongPassword1!", hash); err != ErrPasswordMismatch {
+				t.Errorf("CheckPasswordHash() wrong password error = %v, want ErrPasswordMismatch", err)
+			}
+			if hasher.NeedsRehash(hash) {
+				t.Errorf("NeedsRehash() = true for a hash it just made")
+			}
+		})
+	}
+}
+
+func TestArgon2idPHCFormat(t *testing.T) {
+	hash, _ := testArgon2idHasher.Hash("password")
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("Hash() = %s, want PHC formatted argon2id hash", hash)
+	}
+
+	// Test vector from golang.org/x/crypto/argon2 (password, somesalt, t=1, m=64, p=1)
+	reference := "$argon2id$v=19$m=64,t=1,p=1$c29tZXNhbHQ$ZVrRXqxlLcWfcXCnMyv0m4Rpvh/bnCi7"
+	if err := CheckPasswordHash("password", reference); err != nil {
+		t.Errorf("CheckPasswordHash() reference hash error = %v", err)
+	}
+}
+
+func TestArgon2idLongPasswords(t *testing.T) {
+	prefix := strings.Repeat("a", 72)
+	hash, _ := testArgon2idHasher.Hash(prefix + "1")
+	if err := CheckPasswordHash(prefix+"2", hash); err == nil {
+		t.Errorf("CheckPasswordHash() ignored bytes beyond 72")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	bcryptHash, _ := BcryptHasher{Cost: bcrypt.MinCost}.Hash("password")
+	weakArgon, _ := testArgon2idHasher.Hash("password")
+	stronger := testArgon2idHasher
+	stronger.Iterations = 2
+
+	tests := []struct {
+		name   string
+		hasher PasswordHasher
+		hash   string
+		want   bool
+	}{
+		{name: "bcrypt to argon2id", hasher: testArgon2idHasher, hash: bcryptHash, want: true},
+		{name: "argon2id parameters raised", hasher: stronger, hash: weakArgon, want: true},
+		{name: "argon2id to bcrypt", hasher: BcryptHasher{Cost: bcrypt.MinCost}, hash: weakArgon, want: true},
+		{name: "bcrypt cost raised", hasher: BcryptHasher{Cost: bcrypt.MinCost + 1}, hash: bcryptHash, want: true},
+		{name: "bcrypt unchanged", hasher: BcryptHasher{Cost: bcrypt.MinCost}, hash: bcryptHash, want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.hasher.NeedsRehash(test.hash); got != test.want {
+				t.Errorf("NeedsRehash() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
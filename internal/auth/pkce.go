@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+)
+
+// ValidPKCEVerifier reports whether verifier is a well formed RFC 7636 code
+// verifier: 43 to 128 unreserved characters.
+func ValidPKCEVerifier(verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	for _, c := range verifier {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '-', c == '.', c == '_', c == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ValidPKCEChallenge reports whether challenge could be an S256 code
+// challenge, the base64url encoded SHA-256 digest of a verifier.
+func ValidPKCEChallenge(challenge string) bool {
+	digest, err := base64.RawURLEncoding.DecodeString(challenge)
+	return err == nil && len(digest) == sha256.Size
+}
+
+// PKCEChallenge derives the S256 code challenge for a code verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyPKCE checks a code verifier against an S256 code challenge.
+func VerifyPKCE(verifier, challenge string) bool {
+	if !ValidPKCEVerifier(verifier) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(PKCEChallenge(verifier)), []byte(challenge)) == 1
+}
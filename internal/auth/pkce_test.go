@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{
+			name:      "Matching verifier",
+			verifier:  verifier,
+			challenge: challenge,
+			want:      true,
+		},
+		{
+			name:      "Wrong verifier",
+			verifier:  strings.Replace(verifier, "d", "e", 1),
+			challenge: challenge,
+			want:      false,
+		},
+		{
+			name:      "Plain challenge",
+			verifier:  verifier,
+			challenge: verifier,
+			want:      false,
+		},
+		{
+			name:      "Verifier too short",
+			verifier:  "abc",
+			challenge: challenge,
+			want:      false,
+		},
+		{
+			name:      "Verifier with invalid characters",
+			verifier:  strings.Repeat("a", 42) + "+",
+			challenge: challenge,
+			want:      false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := VerifyPKCE(test.verifier, test.challenge); got != test.want {
+				t.Errorf("VerifyPKCE() = %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	if !ValidPKCEChallenge(challenge) || ValidPKCEChallenge("short") {
+		t.Errorf("ValidPKCEChallenge() gave the wrong answer")
+	}
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// PasswordPolicy describes the rules a new password has to satisfy.
+type PasswordPolicy struct {
+	// MinLength and MaxLength are counted in characters. A MaxLength of zero
+	// means no upper limit.
+	MinLength int
+	MaxLength int
+	// AllowEmail permits a password equal to the account's email address or
+	// its local part.
+	AllowEmail bool
+	// Breached is consulted for known breached passwords when set.
+	Breached BreachedPasswordSource
+}
+
+// DefaultPasswordPolicy follows the NIST SP 800-63B recommendations.
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength: 8,
+	MaxLength: 128,
+	Breached:  BundledBreachedPasswords(),
+}
+
+// PolicyViolation is a single rule a password failed.
+type PolicyViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+const (
+	RuleMinLength = "min_length"
+	RuleMaxLength = "max_length"
+	RuleNotEmail  = "not_email"
+	RuleBreached  = "not_breached"
+)
+
+// Validate checks password against every rule of the policy and returns the
+// ones it fails, or nil when it satisfies them all. An error is only returned
+// when the breached password source could not be consulted.
+func (p PasswordPolicy) Validate(ctx context.Context, password, email string) ([]PolicyViolation, error) {
+	var violations []PolicyViolation
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, PolicyViolation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("Password must be at least %d characters long", p.MinLength),
+		})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, PolicyViolation{
+			Rule:    RuleMaxLength,
+			Message: fmt.Sprintf("Password must be at most %d characters long", p.MaxLength),
+		})
+	}
+
+	if !p.AllowEmail && email != "" {
+		localPart, _, _ := strings.Cut(email, "@")
+		if strings.EqualFold(password, email) || strings.EqualFold(password, localPart) {
+			violations = append(violations, PolicyViolation{
+				Rule:    RuleNotEmail,
+				Message: "Password must not be your email address",
+			})
+		}
+	}
+
+	if p.Breached != nil && password != "" {
+		breached, err := IsBreachedPassword(ctx, p.Breached, password)
+		if err != nil {
+			return violations, fmt.Errorf("Failed to check breached passwords: %w", err)
+		}
+		if breached {
+			violations = append(violations, PolicyViolation{
+				Rule:    RuleBreached,
+				Message: "Password has appeared in a data breach, choose a different one",
+			})
+		}
+	}
+
+	return violations, nil
+}
@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	policy := PasswordPolicy{
+		MinLength: 8,
+		MaxLength: 20,
+		Breached:  BundledBreachedPasswords(),
+	}
+
+	tests := []struct {
+		name      string
+		policy    PasswordPolicy
+		password  string
+		email     string
+		wantRules []string
+	}{
+		{
+			name:     "Acceptable password",
+			policy:   policy,
+			password: "correct horse staple",
+			email:    "user@example.com",
+		},
+		{
+			name:      "Empty password",
+			policy:    policy,
+			password:  "",
+			email:     "user@example.com",
+			wantRules: []string{RuleMinLength},
+		},
+		{
+			name:      "Too long",
+			policy:    policy,
+			password:  strings.Repeat("x", 21),
+			email:     "user@example.com",
+			wantRules: []string{RuleMaxLength},
+		},
+		{
+			name:      "Length counts characters not bytes",
+			policy:    policy,
+			password:  strings.Repeat("é", 8),
+			email:     "user@example.com",
+			wantRules: nil,
+		},
+		{
+			name:      "Email as password",
+			policy:    policy,
+			password:  "Someone@Example.com",
+			email:     "someone@example.com",
+			wantRules: []string{RuleNotEmail},
+		},
+		{
+			name:      "Email local part as password",
+			policy:    policy,
+			password:  "firstname.lastname",
+			email:     "firstname.lastname@example.com",
+			wantRules: []string{RuleNotEmail},
+		},
+		{
+			name:     "Email allowed",
+			policy:   PasswordPolicy{MinLength: 8, AllowEmail: true},
+			password: "someone@example.com",
+			email:    "someone@example.com",
+		},
+		{
+			name:      "Breached password",
+			policy:    policy,
+			password:  "password123",
+			email:     "user@example.com",
+			wantRules: []string{RuleBreached},
+		},
+		{
+			name:      "Every failed rule is reported",
+			policy:    policy,
+			password:  "admin",
+			email:     "admin@example.com",
+			wantRules: []string{RuleMinLength, RuleNotEmail, RuleBreached},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := tt.policy.Validate(context.Background(), tt.password, tt.email)
+			if err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			var rules []string
+			for _, violation := range violations {
+				rules = append(rules, violation.Rule)
+			}
+			if !slices.Equal(rules, tt.wantRules) {
+				t.Errorf("Validate() rules = %v, want %v", rules, tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestBreachedPasswordSources(t *testing.T) {
+	// SHA-1("hunter2") = F3BBBD66A63D4BF1747940578EC3D0103530E21D
+	list, err := LoadBreachedPasswordList(strings.NewReader(
+		"f3bbbd66a63d4bf1747940578ec3d0103530e21d:17\n\n",
+	))
+	if err != nil {
+		t.Fatalf("LoadBreachedPasswordList() error = %v", err)
+	}
+
+	dir := t.TempDir()
+	err = os.WriteFile(filepath.Join(dir, "F3BBB"), []byte("0000000000000000000000000000000000A:1\r\nD66A63D4BF1747940578EC3D0103530E21D:17\r\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sources := map[string]BreachedPasswordSource{
+		"list":      list,
+		"directory": BreachedPasswordDir{Dir: dir},
+	}
+	for name, src := range sources {
+		t.Run(name, func(t *testing.T) {
+			breached, err := IsBreachedPassword(context.Background(), src, "hunter2")
+			if err != nil || !breached {
+				t.Errorf("IsBreachedPassword(hunter2) = %v, %v, want true", breached, err)
+			}
+			breached, err = IsBreachedPassword(context.Background(), src, "hunter3")
+			if err != nil || breached {
+				t.Errorf("IsBreachedPassword(hunter3) = %v, %v, want false", breached, err)
+			}
+		})
+	}
+
+	if _, err := LoadBreachedPasswordList(strings.NewReader("not a digest\n")); err == nil {
+		t.Errorf("LoadBreachedPasswordList() accepted an invalid digest")
+	}
+}
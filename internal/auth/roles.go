@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+)
+
+// Role is a user's role, stored on the users table and carried in the role
+// claim of access tokens.
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Scopes are the permissions an access token grants, carried in its
+// space-separated scope claim.
+const (
+	ScopeChirpsRead     = "chirps:read"
+	ScopeChirpsWrite    = "chirps:write"
+	ScopeChirpsModerate = "chirps:moderate"
+	ScopeUsersRead      = "users:read"
+	ScopeUsersWrite     = "users:write"
+	ScopeUsersAdmin     = "users:admin"
+	// ScopeAccount covers managing the account itself: credentials, sessions,
+	// two-factor authentication and API keys.
+	ScopeAccount = "account"
+)
+
+var roleScopes = map[Role][]string{
+	RoleUser: {
+		ScopeChirpsRead, ScopeChirpsWrite, ScopeUsersRead, ScopeUsersWrite,
+		ScopeAccount,
+	},
+	RoleModerator: {
+		ScopeChirpsRead, ScopeChirpsWrite, ScopeUsersRead, ScopeUsersWrite,
+		ScopeAccount, ScopeChirpsModerate,
+	},
+	RoleAdmin: {
+		ScopeChirpsRead, ScopeChirpsWrite, ScopeUsersRead, ScopeUsersWrite,
+		ScopeAccount, ScopeChirpsModerate, ScopeUsersAdmin,
+	},
+}
+
+// OAuthScopes are the scopes third-party OAuth clients may request, with the
+// description shown on the consent page.
+var OAuthScopes = map[string]string{
+	ScopeChirpsRead:  "Read chirps",
+	ScopeChirpsWrite: "Post and delete chirps as you",
+	ScopeUsersRead:   "See your profile",
+	ScopeUsersWrite:  "Update your profile",
+}
+
+func (r Role) Valid() bool {
+	_, ok := roleScopes[r]
+	return ok
+}
+
+// Scopes returns every scope granted to a user with this role.
+func (r Role) Scopes() []string {
+	return slices.Clone(roleScopes[r])
+}
+
+// HasScope reports whether the token grants scope.
+func (c AccessClaims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+// JoinScopes encodes scopes the way they appear in a scope claim.
+func JoinScopes(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// SplitScopes decodes a space-separated scope string.
+func SplitScopes(scope string) []string {
+	return strings.Fields(scope)
+}
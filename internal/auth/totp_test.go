@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test vectors from RFC 6238 appendix B, truncated to six digits
+func TestValidateTOTP(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		name   string
+		code   string
+		time   time.Time
+		wantOK bool
+	}{
+		{
+			name:   "RFC vector at 59",
+			code:   "287082",
+			time:   time.Unix(59, 0),
+			wantOK: true,
+		},
+		{
+			name:   "RFC vector at 1111111109",
+			code:   "081804",
+			time:   time.Unix(1111111109, 0),
+			wantOK: true,
+		},
+		{
+			name:   "Previous period accepted",
+			code:   "081804",
+			time:   time.Unix(1111111109+totpPeriod, 0),
+			wantOK: true,
+		},
+		{
+			name:   "Code too old",
+			code:   "081804",
+			time:   time.Unix(1111111109+3*totpPeriod, 0),
+			wantOK: false,
+		},
+		{
+			name:   "Wrong code",
+			code:   "000000",
+			time:   time.Unix(59, 0),
+			wantOK: false,
+		},
+		{
+			name:   "Wrong length",
+			code:   "94287082",
+			time:   time.Unix(59, 0),
+			wantOK: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, ok := ValidateTOTP(secret, test.code, test.time)
+			if ok != test.wantOK {
+				t.Errorf("ValidateTOTP() = %v, want %v", ok, test.wantOK)
+			}
+		})
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() error = %v", err)
+	}
+	uri, err := url.Parse(TOTPURI("Chirpy", "user@example.com", secret))
+	if err != nil {
+		t.Fatalf("TOTPURI() is not a valid URI: %v", err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" {
+		t.Errorf("TOTPURI() = %s, want otpauth://totp/...", uri)
+	}
+	if uri.Query().Get("secret") != secret || uri.Query().Get("issuer") != "Chirpy" {
+		t.Errorf("TOTPURI() query = %v", uri.Query())
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes() error = %v", err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 19 || strings.Count(code, "-") != 3 {
+			t.Errorf("unexpected recovery code format %q", code)
+		}
+		seen[code] = true
+	}
+	if len(seen) != 10 {
+		t.Errorf("expected 10 unique codes, got %d", len(seen))
+	}
+
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+	if HashRecoveryCode(typed) != HashRecoveryCode(codes[0]) {
+		t.Errorf("HashRecoveryCode() does not normalise %q", typed)
+	}
+}
@@ -7,25 +7,114 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const countChirpRechirps = `-- name: CountChirpRechirps :many
+SELECT rechirp_of_id::uuid AS chirp_id, COUNT(*) AS rechirp_count
+FROM chirps
+WHERE rechirp_of_id = ANY($1::uuid[])
+GROUP BY rechirp_of_id
+`
+
+type CountChirpRechirpsRow struct {
+	ChirpID      uuid.UUID
+	RechirpCount int64
+}
+
+func (q *Queries) CountChirpRechirps(ctx context.Context, chirpIds []uuid.UUID) ([]CountChirpRechirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, countChirpRechirps, pq.Array(chirpIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountChirpRechirpsRow
+	for rows.Next() {
+		var i CountChirpRechirpsRow
+		if err := rows.Scan(
+			&i.ChirpID,
+			&i.RechirpCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countChirpReplies = `-- name: CountChirpReplies :many
+SELECT reply_to_id::uuid AS chirp_id, COUNT(*) AS reply_count
+FROM chirps
+WHERE reply_to_id = ANY($1::uuid[])
+AND deleted_at IS NULL
+GROUP BY reply_to_id
+`
+
+type CountChirpRepliesRow struct {
+	ChirpID    uuid.UUID
+	ReplyCount int64
+}
+
+func (q *Queries) CountChirpReplies(ctx context.Context, chirpIds []uuid.UUID) ([]CountChirpRepliesRow, error) {
+	rows, err := q.db.QueryContext(ctx, countChirpReplies, pq.Array(chirpIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountChirpRepliesRow
+	for rows.Next() {
+		var i CountChirpRepliesRow
+		if err := rows.Scan(
+			&i.ChirpID,
+			&i.ReplyCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, reply_to_id, rechirp_of_id, quote_of_id)
 VALUES (
-	gen_random_uuid(), NOW(), NOW(), $1, $2
+	gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4, $5
 )
-RETURNING id, created_at,  updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, reply_to_id, deleted_at, rechirp_of_id, quote_of_id
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body        string
+	UserID      uuid.UUID
+	ReplyToID   uuid.NullUUID
+	RechirpOfID uuid.NullUUID
+	QuoteOfID   uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.ReplyToID,
+		arg.RechirpOfID,
+		arg.QuoteOfID,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -33,6 +122,10 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.ReplyToID,
+		&i.DeletedAt,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
 	)
 	return i, err
 }
@@ -47,14 +140,274 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
-const getAllChirps = `-- name: GetAllChirps :many
-SELECT id, created_at, updated_at, body, user_id 
+const deleteRechirp = `-- name: DeleteRechirp :exec
+DELETE FROM chirps
+WHERE user_id = $1
+AND rechirp_of_id = $2
+`
+
+type DeleteRechirpParams struct {
+	UserID      uuid.UUID
+	RechirpOfID uuid.NullUUID
+}
+
+func (q *Queries) DeleteRechirp(ctx context.Context, arg DeleteRechirpParams) error {
+	_, err := q.db.ExecContext(ctx, deleteRechirp, arg.UserID, arg.RechirpOfID)
+	return err
+}
+
+const deleteRechirps = `-- name: DeleteRechirps :exec
+DELETE FROM chirps
+WHERE rechirp_of_id = $1
+`
+
+func (q *Queries) DeleteRechirps(ctx context.Context, rechirpOfID uuid.NullUUID) error {
+	_, err := q.db.ExecContext(ctx, deleteRechirps, rechirpOfID)
+	return err
+}
+
+const getChirp = `-- name: GetChirp :one
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, deleted_at, rechirp_of_id, quote_of_id
+FROM chirps
+WHERE id = $1
+AND deleted_at IS NULL
+`
+
+func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.ReplyToID,
+		&i.DeletedAt,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
+	)
+	return i, err
+}
+
+const getChirpForUpdate = `-- name: GetChirpForUpdate :one
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, deleted_at, rechirp_of_id, quote_of_id
+FROM chirps
+WHERE id = $1
+AND deleted_at IS NULL
+FOR UPDATE
+`
+
+func (q *Queries) GetChirpForUpdate(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpForUpdate, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.ReplyToID,
+		&i.DeletedAt,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
+	)
+	return i, err
+}
+
+const getRechirp = `-- name: GetRechirp :one
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, deleted_at, rechirp_of_id, quote_of_id
+FROM chirps
+WHERE user_id = $1
+AND rechirp_of_id = $2
+`
+
+type GetRechirpParams struct {
+	UserID      uuid.UUID
+	RechirpOfID uuid.NullUUID
+}
+
+func (q *Queries) GetRechirp(ctx context.Context, arg GetRechirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getRechirp, arg.UserID, arg.RechirpOfID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.ReplyToID,
+		&i.DeletedAt,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
+	)
+	return i, err
+}
+
+const listChirpAncestors = `-- name: ListChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+	SELECT parent.*, 1 AS depth
+	FROM chirps parent
+	WHERE parent.id = (SELECT c.reply_to_id FROM chirps c WHERE c.id = $1)
+	UNION ALL
+	SELECT parent.*, ancestors.depth + 1
+	FROM chirps parent
+	JOIN ancestors ON parent.id = ancestors.reply_to_id
+)
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, deleted_at, rechirp_of_id, quote_of_id
+FROM ancestors
+ORDER BY depth DESC
+`
+
+type ListChirpAncestorsRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Body        string
+	UserID      uuid.UUID
+	ReplyToID   uuid.NullUUID
+	DeletedAt   sql.NullTime
+	RechirpOfID uuid.NullUUID
+	QuoteOfID   uuid.NullUUID
+}
+
+func (q *Queries) ListChirpAncestors(ctx context.Context, id uuid.UUID) ([]ListChirpAncestorsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpAncestors, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListChirpAncestorsRow
+	for rows.Next() {
+		var i ListChirpAncestorsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ReplyToID,
+			&i.DeletedAt,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpDescendants = `-- name: ListChirpDescendants :many
+WITH RECURSIVE descendants AS (
+	SELECT reply.*
+	FROM chirps reply
+	WHERE reply.reply_to_id = $1::uuid
+	UNION ALL
+	SELECT reply.*
+	FROM chirps reply
+	JOIN descendants ON reply.reply_to_id = descendants.id
+)
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, deleted_at, rechirp_of_id, quote_of_id
+FROM descendants
+WHERE (
+	$2::timestamp IS NULL
+	OR (created_at, id) > ($2, $3::uuid)
+)
+ORDER BY created_at ASC, id ASC
+LIMIT $4
+`
+
+type ListChirpDescendantsParams struct {
+	ChirpID         uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+type ListChirpDescendantsRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Body        string
+	UserID      uuid.UUID
+	ReplyToID   uuid.NullUUID
+	DeletedAt   sql.NullTime
+	RechirpOfID uuid.NullUUID
+	QuoteOfID   uuid.NullUUID
+}
+
+func (q *Queries) ListChirpDescendants(ctx context.Context, arg ListChirpDescendantsParams) ([]ListChirpDescendantsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpDescendants,
+		arg.ChirpID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListChirpDescendantsRow
+	for rows.Next() {
+		var i ListChirpDescendantsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ReplyToID,
+			&i.DeletedAt,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsAsc = `-- name: ListChirpsAsc :many
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, deleted_at, rechirp_of_id, quote_of_id
 FROM chirps
-ORDER BY created_at ASC
+WHERE ($1::uuid IS NULL OR user_id = $1)
+AND deleted_at IS NULL
+AND (
+	$2::timestamp IS NULL
+	OR (created_at, id) > ($2, $3::uuid)
+)
+ORDER BY created_at ASC, id ASC
+LIMIT $4
 `
 
-func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getAllChirps)
+type ListChirpsAscParams struct {
+	AuthorID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           sql.NullInt32
+}
+
+func (q *Queries) ListChirpsAsc(ctx context.Context, arg ListChirpsAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsAsc,
+		arg.AuthorID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -68,6 +421,10 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.ReplyToID,
+			&i.DeletedAt,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
 		); err != nil {
 			return nil, err
 		}
@@ -82,14 +439,135 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 	return items, nil
 }
 
-const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id
+const listChirpsByIDs = `-- name: ListChirpsByIDs :many
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, deleted_at, rechirp_of_id, quote_of_id
 FROM chirps
+WHERE id = ANY($1::uuid[])
+`
+
+func (q *Queries) ListChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsByIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ReplyToID,
+			&i.DeletedAt,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsDesc = `-- name: ListChirpsDesc :many
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, deleted_at, rechirp_of_id, quote_of_id
+FROM chirps
+WHERE ($1::uuid IS NULL OR user_id = $1)
+AND deleted_at IS NULL
+AND (
+	$2::timestamp IS NULL
+	OR (created_at, id) < ($2, $3::uuid)
+)
+ORDER BY created_at DESC, id DESC
+LIMIT $4
+`
+
+type ListChirpsDescParams struct {
+	AuthorID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           sql.NullInt32
+}
+
+func (q *Queries) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDesc,
+		arg.AuthorID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ReplyToID,
+			&i.DeletedAt,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const tombstoneChirp = `-- name: TombstoneChirp :execrows
+UPDATE chirps
+SET body = '', deleted_at = NOW()
 WHERE id = $1
+AND (
+	EXISTS (SELECT 1 FROM chirps replies WHERE replies.reply_to_id = chirps.id)
+	OR EXISTS (SELECT 1 FROM chirps quotes WHERE quotes.quote_of_id = chirps.id)
+)
 `
 
-func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, getChirp, id)
+func (q *Queries) TombstoneChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, tombstoneChirp, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateChirpBody = `-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, body, user_id, reply_to_id, deleted_at, rechirp_of_id, quote_of_id
+`
+
+type UpdateChirpBodyParams struct {
+	ID   uuid.UUID
+	Body string
+}
+
+func (q *Queries) UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpBody, arg.ID, arg.Body)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -97,6 +575,10 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.ReplyToID,
+		&i.DeletedAt,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
 	)
 	return i, err
 }
@@ -11,27 +11,151 @@ import (
 	"github.com/google/uuid"
 )
 
+type ApiKey struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	ExpiresAt  sql.NullTime
+	RevokedAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	Name       string
+	KeyPrefix  string
+	KeyHash    string
+	Scopes     string
+	UserID     uuid.UUID
+}
+
 type Chirp struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Body        string
+	UserID      uuid.UUID
+	ReplyToID   uuid.NullUUID
+	DeletedAt   sql.NullTime
+	RechirpOfID uuid.NullUUID
+	QuoteOfID   uuid.NullUUID
+}
+
+type ChirpRevision struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	ReplacedAt time.Time
+	Body       string
+	ChirpID    uuid.UUID
+}
+
+type EmailVerificationToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+	Email     string
+	UserID    uuid.UUID
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type Like struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type MagicLinkToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+	UserID    uuid.UUID
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash      string
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+	UsedAt        sql.NullTime
+	ClientID      uuid.UUID
+	UserID        uuid.UUID
+	RedirectUri   string
+	Scopes        string
+	CodeChallenge string
+}
+
+type OauthClient struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	Name          string
+	SecretHash    sql.NullString
+	RedirectUris  string
+	UserID        uuid.UUID
+	CanIntrospect bool
+}
+
+type PasswordResetToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+	UserID    uuid.UUID
+}
+
+type RecoveryCode struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
-	UpdatedAt time.Time
-	Body      string
+	UsedAt    sql.NullTime
+	CodeHash  string
 	UserID    uuid.UUID
 }
 
 type RefreshToken struct {
-	Token     string
+	TokenHash  string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	UserID     uuid.UUID
+	FamilyID   uuid.UUID
+	ReplacedBy sql.NullString
+	UserAgent  string
+	IpAddress  string
+	LastUsedAt time.Time
+	ClientID   uuid.NullUUID
+	Scopes     sql.NullString
+}
+
+type RevokedAccessToken struct {
+	Jti       string
 	CreatedAt time.Time
-	UpdatedAt time.Time
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
 	UserID    uuid.UUID
 }
 
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Email           string
+	HashedPassword  string
+	IsChirpyRed     bool
+	EmailVerifiedAt sql.NullTime
+	TotpSecret      sql.NullString
+	TotpEnabledAt   sql.NullTime
+	TotpLastStep    sql.NullInt64
+	Role            string
+}
+
+type UserIdentity struct {
+	Issuer    string
+	Subject   string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+}
+
+type UserTokenCutoff struct {
+	UserID    uuid.UUID
+	NotBefore time.Time
 }
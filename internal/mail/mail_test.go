@@ -0,0 +1,45 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer := &FileMailer{Dir: dir, From: "chirpy@example.com"}
+
+	err := mailer.Send(context.Background(), Message{
+		To:      "user@example.com",
+		Subject: "Reset your password",
+		Body:    "token: abc123",
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("expected 1 message file, got %d", len(files))
+	}
+	data, _ := os.ReadFile(files[0])
+	for _, want := range []string{"To: user@example.com\r\n", "Subject: Reset your password\r\n", "token: abc123"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("message missing %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestHeaderInjection(t *testing.T) {
+	mailer := &FileMailer{Dir: t.TempDir(), From: "chirpy@example.com"}
+	err := mailer.Send(context.Background(), Message{
+		To:      "user@example.com\r\nBcc: victim@example.com",
+		Subject: "Hi",
+	})
+	if err == nil {
+		t.Errorf("Send() accepted a recipient containing a line break")
+	}
+}
@@ -0,0 +1,268 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeProvider is a minimal in-process OpenID provider.
+type fakeProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	keyID  string
+	// claims returns the claims of the ID token issued for a code
+	claims      func(code string) jwt.MapClaims
+	codeChecked func(form url.Values) bool
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeProvider{key: key, keyID: "key-1"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Metadata{
+			Issuer:                fake.server.URL,
+			AuthorizationEndpoint: fake.server.URL + "/authorize",
+			TokenEndpoint:         fake.server.URL + "/token",
+			JWKSURI:               fake.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(auth.JWKS{Keys: []auth.JWK{{
+			KeyType:   "RSA",
+			KeyID:     fake.keyID,
+			Use:       "sig",
+			Algorithm: "RS256",
+			N:         base64.RawURLEncoding.EncodeToString(fake.key.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(fake.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		id, secret, _ := r.BasicAuth()
+		if id != "chirpy" || secret != "s3cret" || (fake.codeChecked != nil && !fake.codeChecked(r.PostForm)) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "opaque",
+			"token_type":   "Bearer",
+			"id_token":     fake.sign(t, fake.claims(r.PostForm.Get("code"))),
+		})
+	})
+	fake.server = httptest.NewServer(mux)
+	t.Cleanup(fake.server.Close)
+	return fake
+}
+
+func (f *fakeProvider) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = f.keyID
+	signed, err := token.SignedString(f.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func (f *fakeProvider) validClaims(nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            f.server.URL,
+		"sub":            "employee-42",
+		"aud":            "chirpy",
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          nonce,
+		"email":          "employee@example.com",
+		"email_verified": true,
+	}
+}
+
+func (f *fakeProvider) provider() *Provider {
+	return NewProvider(Config{
+		Issuer:       f.server.URL,
+		ClientID:     "chirpy",
+		ClientSecret: "s3cret",
+		RedirectURL:  "https://chirpy.example.com/api/login/oidc/callback",
+		Scopes:       []string{"email"},
+	})
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	fake := newFakeProvider(t)
+	provider := fake.provider()
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "state-1", "nonce-1", "challenge-1")
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	parsed, _ := url.Parse(authURL)
+	query := parsed.Query()
+	if parsed.Path != "/authorize" {
+		t.Errorf("AuthCodeURL() path = %s, want /authorize", parsed.Path)
+	}
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             "chirpy",
+		"redirect_uri":          "https://chirpy.example.com/api/login/oidc/callback",
+		"scope":                 "openid email",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        "challenge-1",
+		"code_challenge_method": "S256",
+	}
+	for name, value := range want {
+		if got := query.Get(name); got != value {
+			t.Errorf("AuthCodeURL() %s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestExchangeAndVerify(t *testing.T) {
+	fake := newFakeProvider(t)
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	fake.codeChecked = func(form url.Values) bool {
+		return form.Get("code_verifier") == verifier && form.Get("redirect_uri") != ""
+	}
+
+	tests := []struct {
+		name    string
+		claims  func(jwt.MapClaims)
+		nonce   string
+		want    Claims
+		wantErr bool
+	}{
+		{
+			name:  "Valid token",
+			nonce: "nonce-1",
+			want: Claims{
+				Subject:       "employee-42",
+				Email:         "employee@example.com",
+				EmailVerified: true,
+			},
+		},
+		{
+			name:   "String email_verified",
+			claims: func(c jwt.MapClaims) { c["email_verified"] = "true" },
+			nonce:  "nonce-1",
+			want: Claims{
+				Subject:       "employee-42",
+				Email:         "employee@example.com",
+				EmailVerified: true,
+			},
+		},
+		{
+			name:   "Unverified email",
+			claims: func(c jwt.MapClaims) { c["email_verified"] = false },
+			nonce:  "nonce-1",
+			want: Claims{
+				Subject: "employee-42",
+				Email:   "employee@example.com",
+			},
+		},
+		{
+			name:    "Wrong nonce",
+			nonce:   "nonce-2",
+			wantErr: true,
+		},
+		{
+			name:    "Wrong audience",
+			claims:  func(c jwt.MapClaims) { c["aud"] = "someone-else" },
+			nonce:   "nonce-1",
+			wantErr: true,
+		},
+		{
+			name:    "Wrong issuer",
+			claims:  func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+			nonce:   "nonce-1",
+			wantErr: true,
+		},
+		{
+			name:    "Expired",
+			claims:  func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+			nonce:   "nonce-1",
+			wantErr: true,
+		},
+		{
+			name:    "Issued to another party",
+			claims:  func(c jwt.MapClaims) { c["aud"] = []string{"chirpy", "other"}; c["azp"] = "other" },
+			nonce:   "nonce-1",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake.claims = func(code string) jwt.MapClaims {
+				claims := fake.validClaims("nonce-1")
+				if test.claims != nil {
+					test.claims(claims)
+				}
+				return claims
+			}
+			provider := fake.provider()
+
+			idToken, err := provider.Exchange(context.Background(), "code-1", verifier)
+			if err != nil {
+				t.Fatalf("Exchange() error = %v", err)
+			}
+			got, err := provider.VerifyIDToken(context.Background(), idToken, test.nonce)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("VerifyIDToken() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("VerifyIDToken() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+
+	if _, err := fake.provider().Exchange(context.Background(), "code-1", "wrong-verifier"); err == nil {
+		t.Errorf("Exchange() succeeded with the wrong code verifier")
+	}
+}
+
+func TestVerifyIDTokenRejectsForgedTokens(t *testing.T) {
+	fake := newFakeProvider(t)
+	provider := fake.provider()
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, fake.validClaims("nonce-1"))
+	forged.Header["kid"] = fake.keyID
+	forgedToken, _ := forged.SignedString(otherKey)
+	if _, err := provider.VerifyIDToken(context.Background(), forgedToken, "nonce-1"); err == nil {
+		t.Errorf("VerifyIDToken() accepted a token signed by another key")
+	}
+
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodNone, fake.validClaims("nonce-1"))
+	unsignedToken, _ := unsigned.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if _, err := provider.VerifyIDToken(context.Background(), unsignedToken, "nonce-1"); err == nil {
+		t.Errorf("VerifyIDToken() accepted an unsigned token")
+	}
+
+	// Rotated keys are picked up from the JWKS
+	fake.key, _ = rsa.GenerateKey(rand.Reader, 2048)
+	fake.keyID = "key-2"
+	provider.keysFetchedAt = time.Time{}
+	if _, err := provider.VerifyIDToken(context.Background(), fake.sign(t, fake.validClaims("nonce-1")), "nonce-1"); err != nil {
+		t.Errorf("VerifyIDToken() with rotated key error = %v", err)
+	}
+}
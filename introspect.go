@@ -0,0 +1,124 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+)
+
+// introspectionResponse is a token introspection response as defined by
+// RFC 7662. Inactive tokens only report active as false.
+type introspectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenID   string `json:"jti,omitempty"`
+	Role      string `json:"role,omitempty"`
+}
+
+func newAccessTokenIntrospection(claims auth.AccessClaims) introspectionResponse {
+	return introspectionResponse{
+		Active:    true,
+		Scope:     auth.JoinScopes(claims.Scopes),
+		TokenType: "access_token",
+		ExpiresAt: claims.ExpiresAt.Unix(),
+		IssuedAt:  claims.IssuedAt.Unix(),
+		Subject:   claims.UserID.String(),
+		TokenID:   claims.TokenID,
+		Role:      string(claims.Role),
+	}
+}
+
+func newRefreshTokenIntrospection(token database.GetUserFromRefreshTokenRow) introspectionResponse {
+	role := auth.Role(token.Role)
+	// First-party sessions can mint tokens with every scope of the user's role
+	scope := auth.JoinScopes(role.Scopes())
+	clientID := ""
+	if token.ClientID.Valid {
+		scope = token.Scopes.String
+		clientID = token.ClientID.UUID.String()
+	}
+	return introspectionResponse{
+		Active:    true,
+		Scope:     scope,
+		ClientID:  clientID,
+		TokenType: "refresh_token",
+		ExpiresAt: token.ExpiresAt.Unix(),
+		IssuedAt:  token.CreatedAt.Unix(),
+		Subject:   token.UserID.String(),
+		Role:      token.Role,
+	}
+}
+
+// handlerIntrospectToken tells resource servers whether an access or refresh
+// token is currently valid, and for whom. Only confidential clients an admin
+// has allowed to introspect may call it.
+func (cfg *apiConfig) handlerIntrospectToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, &oauthError{Code: "invalid_request"})
+		return
+	}
+
+	client, err := cfg.authenticateOAuthClient(r)
+	if err == nil && !client.SecretHash.Valid {
+		err = errors.New("public clients can't introspect tokens")
+	}
+	if err == nil && !client.CanIntrospect {
+		err = errors.New("client isn't allowed to introspect tokens")
+	}
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+		respondWithOAuthError(w, http.StatusUnauthorized, &oauthError{
+			Code:        "invalid_client",
+			Description: err.Error(),
+		})
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		respondWithOAuthError(w, http.StatusBadRequest, &oauthError{
+			Code:        "invalid_request",
+			Description: "token is required",
+		})
+		return
+	}
+
+	response := introspectionResponse{}
+	if claims, err := cfg.validateAccessToken(r.Context(), token); err == nil {
+		response = newAccessTokenIntrospection(claims)
+	} else {
+		refreshToken, err := cfg.db.GetUserFromRefreshToken(r.Context(), auth.HashToken(token))
+		// Refresh tokens are only reported to the client they were issued to
+		if err == nil && refreshToken.ClientID.Valid && refreshToken.ClientID.UUID == client.ID {
+			response = newRefreshTokenIntrospection(refreshToken)
+		} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to look up refresh token for introspection: %v", err)
+			respondWithOAuthError(w, http.StatusInternalServerError, &oauthError{Code: "server_error"})
+			return
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJson(w, http.StatusOK, response)
+}
+
+// handlerMe returns the user the access token or API key belongs to.
+func (cfg *apiConfig) handlerMe(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	user, err := cfg.db.GetUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "User does not exist",
+		})
+		return
+	}
+	respondWithJson(w, http.StatusOK, newUserJson(user))
+}
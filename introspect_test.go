@@ -0,0 +1,193 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestIntrospectionResponse(t *testing.T) {
+	userID := uuid.New()
+	clientID := uuid.New()
+	issued := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name     string
+		response introspectionResponse
+		want     introspectionResponse
+	}{
+		{
+			name: "Access token",
+			response: newAccessTokenIntrospection(auth.AccessClaims{
+				UserID:    userID,
+				TokenID:   "jti-1",
+				IssuedAt:  issued,
+				ExpiresAt: issued.Add(time.Hour),
+				Role:      auth.RoleUser,
+				Scopes:    []string{auth.ScopeChirpsRead},
+			}),
+			want: introspectionResponse{
+				Active:    true,
+				Scope:     auth.ScopeChirpsRead,
+				TokenType: "access_token",
+				ExpiresAt: issued.Add(time.Hour).Unix(),
+				IssuedAt:  issued.Unix(),
+				Subject:   userID.String(),
+				TokenID:   "jti-1",
+				Role:      "user",
+			},
+		},
+		{
+			name: "First-party refresh token",
+			response: newRefreshTokenIntrospection(database.GetUserFromRefreshTokenRow{
+				UserID:    userID,
+				CreatedAt: issued,
+				ExpiresAt: issued.Add(7 * 24 * time.Hour),
+				Role:      "user",
+			}),
+			want: introspectionResponse{
+				Active:    true,
+				Scope:     auth.JoinScopes(auth.RoleUser.Scopes()),
+				TokenType: "refresh_token",
+				ExpiresAt: issued.Add(7 * 24 * time.Hour).Unix(),
+				IssuedAt:  issued.Unix(),
+				Subject:   userID.String(),
+				Role:      "user",
+			},
+		},
+		{
+			name: "OAuth client refresh token",
+			response: newRefreshTokenIntrospection(database.GetUserFromRefreshTokenRow{
+				UserID:    userID,
+				CreatedAt: issued,
+				ExpiresAt: issued.Add(7 * 24 * time.Hour),
+				ClientID:  uuid.NullUUID{UUID: clientID, Valid: true},
+				Scopes:    sql.NullString{String: auth.ScopeChirpsRead, Valid: true},
+				Role:      "admin",
+			}),
+			want: introspectionResponse{
+				Active:    true,
+				Scope:     auth.ScopeChirpsRead,
+				ClientID:  clientID.String(),
+				TokenType: "refresh_token",
+				ExpiresAt: issued.Add(7 * 24 * time.Hour).Unix(),
+				IssuedAt:  issued.Unix(),
+				Subject:   userID.String(),
+				Role:      "admin",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.response != test.want {
+				t.Errorf("got %+v, want %+v", test.response, test.want)
+			}
+		})
+	}
+}
+
+func TestInactiveIntrospectionResponse(t *testing.T) {
+	// RFC 7662 2.2: nothing about an inactive token may be disclosed
+	body, err := json.Marshal(introspectionResponse{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != `{"active":false}` {
+		t.Errorf("inactive response = %s, want {\"active\":false}", body)
+	}
+}
+
+func TestIntrospectTokenClients(t *testing.T) {
+	clientID := uuid.New()
+	otherClientID := uuid.New()
+	clientColumns := []string{"id", "created_at", "name", "secret_hash", "redirect_uris", "user_id", "can_introspect"}
+	refreshColumns := []string{"user_id", "created_at", "expires_at", "client_id", "scopes", "role"}
+
+	tests := []struct {
+		name          string
+		canIntrospect bool
+		tokenClientID uuid.NullUUID
+		wantStatus    int
+		wantActive    bool
+	}{
+		{
+			name:       "Client not allowed to introspect",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:          "Refresh token of the calling client",
+			canIntrospect: true,
+			tokenClientID: uuid.NullUUID{UUID: clientID, Valid: true},
+			wantStatus:    http.StatusOK,
+			wantActive:    true,
+		},
+		{
+			name:          "Refresh token of another client",
+			canIntrospect: true,
+			tokenClientID: uuid.NullUUID{UUID: otherClientID, Valid: true},
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "First-party refresh token",
+			canIntrospect: true,
+			wantStatus:    http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, mock := newMockConfig(t)
+			useTestKeys(t, cfg)
+
+			mock.ExpectQuery(queryName("GetOAuthClient")).
+				WillReturnRows(sqlmock.NewRows(clientColumns).AddRow(
+					clientID.String(), time.Now(), "resource server", auth.HashToken("s3cret"),
+					"https://rs.example.com/callback", uuid.NewString(), test.canIntrospect,
+				))
+			if test.canIntrospect {
+				var scopes any
+				if test.tokenClientID.Valid {
+					scopes = auth.ScopeChirpsRead
+				}
+				mock.ExpectQuery(queryName("GetUserFromRefreshToken")).
+					WillReturnRows(sqlmock.NewRows(refreshColumns).AddRow(
+						uuid.NewString(), time.Now(), time.Now().Add(time.Hour),
+						nullUUIDValue(test.tokenClientID), scopes, "user",
+					))
+			}
+
+			form := url.Values{
+				"client_id":     {clientID.String()},
+				"client_secret": {"s3cret"},
+				"token":         {"some-refresh-token"},
+			}
+			req := httptest.NewRequest(http.MethodPost, "/api/token/introspect", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			cfg.handlerIntrospectToken(rec, req)
+
+			if rec.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, test.wantStatus, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			var got introspectionResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Active != test.wantActive {
+				t.Errorf("active = %v, want %v: %s", got.Active, test.wantActive, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/JakeBurrell/chirpy/internal/auth"
+)
+
+// loadJWTKeys builds the token key set from the environment.
+//
+// JWT_SIGNING_KEY_FILE points at a PEM Ed25519 or RSA private key used to sign
+// new tokens, named by JWT_SIGNING_KEY_ID. JWT_VERIFICATION_KEYS lists
+// additional kid=path pairs of public keys that are still accepted, so a
+// retired signing key keeps validating tokens until they expire. Without a
+// signing key file tokens fall back to HS256 with SECRET.
+func loadJWTKeys() (*auth.KeySet, error) {
+	var signing *auth.SigningKey
+	if keyFile := os.Getenv("JWT_SIGNING_KEY_FILE"); keyFile != "" {
+		keyID := os.Getenv("JWT_SIGNING_KEY_ID")
+		if keyID == "" {
+			return nil, errors.New("JWT_SIGNING_KEY_ID must be set with JWT_SIGNING_KEY_FILE")
+		}
+		key, err := auth.LoadPrivateKeyFile(keyID, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		signing = key
+	} else {
+		secret := os.Getenv("SECRET")
+		if secret == "" {
+			return nil, errors.New("either JWT_SIGNING_KEY_FILE or SECRET must be set")
+		}
+		signing = auth.NewHMACKey("default", secret)
+	}
+
+	verification := []*auth.SigningKey{}
+	for _, entry := range strings.Split(os.Getenv("JWT_VERIFICATION_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		keyID, path, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid JWT_VERIFICATION_KEYS entry %q, expected kid=path", entry)
+		}
+		key, err := auth.LoadPublicKeyFile(keyID, path)
+		if err != nil {
+			return nil, err
+		}
+		verification = append(verification, key)
+	}
+
+	return auth.NewKeySet(signing, verification...)
+}
+
+func (cfg *apiConfig) handlerJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJson(w, http.StatusOK, cfg.jwtKeys.JWKS())
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// handlerLikeChirp records that the caller likes a chirp. Liking a chirp
+// twice has no further effect.
+func (cfg *apiConfig) handlerLikeChirp(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Invalid chirp id provided",
+		})
+		return
+	}
+
+	if _, err := cfg.db.GetChirp(r.Context(), chirpID); err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Chirp does not exist",
+		})
+		return
+	}
+
+	err = cfg.db.LikeChirp(r.Context(), database.LikeChirpParams{
+		UserID:  claims.UserID,
+		ChirpID: chirpID,
+	})
+	// The chirp was deleted after it was looked up
+	if isForeignKeyViolation(err) {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Chirp does not exist",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to like chirp %s for user %s: %v", chirpID, claims.UserID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerUnlikeChirp removes the caller's like from a chirp. It succeeds
+// whether or not the chirp was liked.
+func (cfg *apiConfig) handlerUnlikeChirp(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Invalid chirp id provided",
+		})
+		return
+	}
+
+	err = cfg.db.UnlikeChirp(r.Context(), database.UnlikeChirpParams{
+		UserID:  claims.UserID,
+		ChirpID: chirpID,
+	})
+	if err != nil {
+		log.Printf("Failed to unlike chirp %s for user %s: %v", chirpID, claims.UserID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerUserLikes lists the chirps a user has liked, most recently liked
+// first.
+func (cfg *apiConfig) handlerUserLikes(w http.ResponseWriter, r *http.Request, viewer uuid.NullUUID) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Invalid user id provided",
+		})
+		return
+	}
+
+	limit, err := parseLimit(r)
+	if err != nil {
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	cursorCreatedAt := sql.NullTime{}
+	cursorID := uuid.NullUUID{}
+	if cursorStr := r.URL.Query().Get("cursor"); cursorStr != "" {
+		cursor, err := decodeCursor(cursorStr)
+		if err != nil {
+			respondWithJson(w, http.StatusBadRequest, errorResponse{
+				Error: "Invalid cursor provided",
+			})
+			return
+		}
+		cursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		cursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+
+	if _, err := cfg.db.GetUserByID(r.Context(), userID); err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "User does not exist",
+		})
+		return
+	}
+
+	// Fetch one extra row to find out whether another page follows
+	liked, err := cfg.db.ListUserLikes(r.Context(), database.ListUserLikesParams{
+		UserID:          userID,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		Limit:           int32(limit + 1),
+	})
+	if err != nil {
+		log.Printf("Failed to list likes of user %s: %v", userID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	page := chirpsPageJson{}
+	if len(liked) > limit {
+		liked = liked[:limit]
+		// Pages follow the order of the likes, not of the chirps
+		last := liked[len(liked)-1]
+		page.NextCursor = encodeCursor(pageCursor{CreatedAt: last.LikedAt, ID: last.ID})
+	}
+
+	chirps := make([]database.Chirp, 0, len(liked))
+	for _, row := range liked {
+		chirps = append(chirps, database.Chirp{
+			ID:          row.ID,
+			CreatedAt:   row.CreatedAt,
+			UpdatedAt:   row.UpdatedAt,
+			Body:        row.Body,
+			UserID:      row.UserID,
+			ReplyToID:   row.ReplyToID,
+			DeletedAt:   row.DeletedAt,
+			RechirpOfID: row.RechirpOfID,
+			QuoteOfID:   row.QuoteOfID,
+		})
+	}
+	page.Chirps, err = cfg.newChirpsJson(r.Context(), chirps, viewer)
+	if err != nil {
+		log.Printf("Failed to load liked chirp details for user %s: %v", userID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, page)
+}
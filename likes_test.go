@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestLikeChirpTwice(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	userID := uuid.New()
+	chirp := database.Chirp{ID: uuid.New(), Body: "hello", UserID: uuid.New()}
+
+	// A second like is absorbed by the conflict clause rather than failing
+	for range 2 {
+		mock.ExpectQuery(queryName("GetChirp")).WillReturnRows(mockChirpRows(chirp))
+		mock.ExpectExec(queryName("LikeChirp")+`(?s).*ON CONFLICT \(user_id, chirp_id\) DO NOTHING`).
+			WithArgs(userID.String(), chirp.ID.String()).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+
+	for i := range 2 {
+		req := httptest.NewRequest(http.MethodPut, "/api/chirps/"+chirp.ID.String()+"/like", nil)
+		req.SetPathValue("chirpID", chirp.ID.String())
+		rec := httptest.NewRecorder()
+		cfg.handlerLikeChirp(rec, req, auth.AccessClaims{UserID: userID})
+
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("like %d: status = %d, want %d: %s", i+1, rec.Code, http.StatusNoContent, rec.Body)
+		}
+	}
+}
+
+func TestChirpLikeCounts(t *testing.T) {
+	liked := database.Chirp{ID: uuid.New(), Body: "liked"}
+	unliked := database.Chirp{ID: uuid.New(), Body: "unliked"}
+	viewerID := uuid.New()
+
+	tests := []struct {
+		name      string
+		viewer    uuid.NullUUID
+		wantLiked string
+	}{
+		{
+			name:      "Anonymous viewer",
+			wantLiked: "",
+		},
+		{
+			name:      "Logged in viewer",
+			viewer:    uuid.NullUUID{UUID: viewerID, Valid: true},
+			wantLiked: "true",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, mock := newMockConfig(t)
+			mock.ExpectQuery(queryName("CountChirpReplies")).
+				WillReturnRows(sqlmock.NewRows([]string{"chirp_id", "reply_count"}))
+			mock.ExpectQuery(queryName("CountChirpRechirps")).
+				WillReturnRows(sqlmock.NewRows([]string{"chirp_id", "rechirp_count"}))
+			// Chirps nobody has liked have no row
+			mock.ExpectQuery(queryName("CountChirpLikes")).
+				WithArgs(nullUUIDValue(test.viewer), sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows([]string{"chirp_id", "like_count", "liked_by_viewer"}).
+					AddRow(liked.ID.String(), 3, test.viewer.Valid))
+
+			chirps, err := cfg.newChirpsJsonWithCounts(t.Context(), []database.Chirp{liked, unliked}, test.viewer)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantCounts := []int64{3, 0}
+			wantLiked := []string{test.wantLiked, ""}
+			if test.viewer.Valid {
+				wantLiked[1] = "false"
+			}
+			for i, chirp := range chirps {
+				body, err := json.Marshal(chirp)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got map[string]json.RawMessage
+				if err := json.Unmarshal(body, &got); err != nil {
+					t.Fatal(err)
+				}
+				if chirp.LikeCount != wantCounts[i] {
+					t.Errorf("chirp %d: like_count = %d, want %d", i, chirp.LikeCount, wantCounts[i])
+				}
+				if string(got["liked_by_me"]) != wantLiked[i] {
+					t.Errorf("chirp %d: liked_by_me = %s, want %q", i, got["liked_by_me"], wantLiked[i])
+				}
+			}
+		})
+	}
+}
+
+func TestUserLikesPaging(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	user := database.User{ID: uuid.New(), Email: "walt@example.com"}
+	now := time.Now().UTC().Truncate(time.Second)
+
+	// Liked in a different order from the one they were posted in
+	type likedChirp struct {
+		chirp   database.Chirp
+		likedAt time.Time
+	}
+	liked := []likedChirp{
+		{database.Chirp{ID: uuid.New(), CreatedAt: now.Add(-3 * time.Hour), Body: "a", UserID: uuid.New()}, now.Add(-time.Minute)},
+		{database.Chirp{ID: uuid.New(), CreatedAt: now.Add(-time.Hour), Body: "b", UserID: uuid.New()}, now.Add(-2 * time.Minute)},
+		{database.Chirp{ID: uuid.New(), CreatedAt: now.Add(-2 * time.Hour), Body: "c", UserID: uuid.New()}, now.Add(-3 * time.Minute)},
+	}
+	rows := sqlmock.NewRows(append(chirpColumns, "liked_at"))
+	for _, like := range liked {
+		rows.AddRow(
+			like.chirp.ID.String(), like.chirp.CreatedAt, like.chirp.CreatedAt, like.chirp.Body,
+			like.chirp.UserID.String(), nil, nil, nil, nil, like.likedAt,
+		)
+	}
+
+	cursor := pageCursor{CreatedAt: now, ID: uuid.New()}
+	mock.ExpectQuery(queryName("GetUserByID")).WillReturnRows(mockUserRows(user))
+	// One extra row shows there is a next page
+	mock.ExpectQuery(queryName("ListUserLikes")).
+		WithArgs(user.ID.String(), cursor.CreatedAt, cursor.ID.String(), 3).
+		WillReturnRows(rows)
+	// The counts for the whole page take one query each, however many
+	// chirps it holds
+	expectChirpCounts(mock, chirpCounts{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/"+user.ID.String()+"/likes?limit=2&cursor="+encodeCursor(cursor), nil)
+	req.SetPathValue("userID", user.ID.String())
+	rec := httptest.NewRecorder()
+	cfg.handlerUserLikes(rec, req, uuid.NullUUID{})
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var got chirpsPageJson
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Chirps) != 2 || got.Chirps[0].ID != liked[0].chirp.ID || got.Chirps[1].ID != liked[1].chirp.ID {
+		t.Errorf("chirps = %+v, want the two most recently liked", got.Chirps)
+	}
+	next, err := decodeCursor(got.NextCursor)
+	if err != nil {
+		t.Fatalf("next_cursor %q: %v", got.NextCursor, err)
+	}
+	// Pages follow when chirps were liked, not when they were posted
+	if next.ID != liked[1].chirp.ID || !next.CreatedAt.Equal(liked[1].likedAt) {
+		t.Errorf("next_cursor = %+v, want the like of the last chirp on the page", next)
+	}
+}
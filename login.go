@@ -1,9 +1,12 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/JakeBurrell/chirpy/internal/auth"
@@ -14,6 +17,9 @@ import (
 type LoginRequest struct {
 	Password string `json:"password"`
 	Email    string `json:"email"`
+	// UseCookies asks for the session to be kept in cookies rather than
+	// returned in the response
+	UseCookies bool `json:"use_cookies"`
 }
 
 type LoginResponse struct {
@@ -21,8 +27,11 @@ type LoginResponse struct {
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 	Email        string    `json:"email"`
-	Token        string    `json:"token"`
-	RefreshToken string    `json:"refresh_token"`
+	Token        string    `json:"token,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	CSRFToken    string    `json:"csrf_token,omitempty"`
+	IsChirpyRed  bool      `json:"is_chirpy_red"`
+	Role         string    `json:"role"`
 }
 
 func (cfg *apiConfig) handleLogin(w http.ResponseWriter, r *http.Request) {
@@ -37,56 +46,203 @@ func (cfg *apiConfig) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := cfg.db.GetUserByEmail(r.Context(), params.Email)
+	user, err := cfg.verifyCredentials(r, params.Email, params.Password)
 	if err != nil {
-		respondWithJson(w, http.StatusBadRequest, errorResponse{
-			Error: "User does not exist",
-		})
+		cfg.respondWithCredentialError(w, err)
 		return
 	}
 
-	err = auth.CheckPasswordHash(params.Password, user.HashedPassword)
-	if err != nil {
-		respondWithJson(w, http.StatusUnauthorized, errorResponse{
-			Error: "Incorrect email or password",
+	cfg.respondWithFirstFactor(w, r, user, params.UseCookies)
+}
+
+// respondWithFirstFactor finishes a login once the user has proven their
+// identity, unless their account also needs a second factor.
+func (cfg *apiConfig) respondWithFirstFactor(w http.ResponseWriter, r *http.Request, user database.User, useCookies bool) {
+	// Accounts with two-factor authentication enabled have to finish logging
+	// in at /api/login/2fa
+	if user.TotpEnabledAt.Valid {
+		mfaToken, err := auth.MakeMFAToken(user.ID, cfg.jwtKeys, mfaTokenLifetime)
+		if err != nil {
+			log.Printf("failed to create mfa token: %v", err)
+			respondWithJson(w, http.StatusInternalServerError, errorResponse{
+				Error: "Failed to create token",
+			})
+			return
+		}
+		respondWithJson(w, http.StatusOK, mfaRequiredResponse{
+			MFARequired: true,
+			MFAToken:    mfaToken,
 		})
 		return
 	}
 
-	token, err := auth.MakeJWT(user.ID, cfg.secret, time.Hour)
-	if err != nil {
-		log.Printf("failed to create jwt token: %v", err)
-		respondWithJson(w, http.StatusInternalServerError, errorResponse{
-			Error: "Failed to create token",
-		})
-	}
+	cfg.respondWithLogin(w, r, user, useCookies)
+}
 
-	refreshToken, err := auth.MakeRefreshToken()
+// respondWithLogin issues a new access token and refresh token session for a
+// user who has completed every login step. With useCookies the tokens are set
+// as cookies and only the csrf token is returned.
+func (cfg *apiConfig) respondWithLogin(w http.ResponseWriter, r *http.Request, user database.User, useCookies bool) {
+	token, err := cfg.makeAccessToken(user)
 	if err != nil {
-		log.Printf("failed to create refresh token")
+		log.Printf("failed to create jwt token: %v", err)
 		respondWithJson(w, http.StatusInternalServerError, errorResponse{
 			Error: "Failed to create token",
 		})
+		return
 	}
 
-	err = cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:  refreshToken,
-		UserID: user.ID,
+	refreshToken, err := cfg.createRefreshToken(r, cfg.db, refreshTokenFamily{
+		UserID:   user.ID,
+		FamilyID: uuid.New(),
 	})
 	if err != nil {
-		log.Printf("failed to add refresh token to database")
+		log.Printf("failed to create refresh token: %v", err)
 		respondWithJson(w, http.StatusInternalServerError, errorResponse{
 			Error: "Failed to create token",
 		})
+		return
 	}
 
-	respondWithJson(w, http.StatusOK, LoginResponse{
+	response := LoginResponse{
 		ID:           user.ID,
+		Role:         user.Role,
 		CreatedAt:    user.CreatedAt,
 		UpdatedAt:    user.UpdatedAt,
 		Email:        user.Email,
 		Token:        token,
 		RefreshToken: refreshToken,
+		IsChirpyRed:  user.IsChirpyRed,
+	}
+	if useCookies {
+		csrfToken, err := auth.MakeOpaqueToken()
+		if err != nil {
+			log.Printf("failed to create csrf token: %v", err)
+			respondWithJson(w, http.StatusInternalServerError, errorResponse{
+				Error: "Failed to create token",
+			})
+			return
+		}
+		setSessionCookies(w, token, refreshToken, csrfToken)
+		response.Token = ""
+		response.RefreshToken = ""
+		response.CSRFToken = csrfToken
+	}
+	respondWithJson(w, http.StatusOK, response)
+}
+
+// makeAccessToken issues an access token carrying the user's role and every
+// scope it grants.
+func (cfg *apiConfig) makeAccessToken(user database.User) (string, error) {
+	role := auth.Role(user.Role)
+	return auth.MakeJWT(user.ID, role, role.Scopes(), cfg.jwtKeys, accessTokenLifetime)
+}
+
+var errInvalidCredentials = errors.New("incorrect email or password")
+
+type loginThrottledError struct {
+	retryAfter time.Duration
+}
+
+func (e *loginThrottledError) Error() string {
+	return "too many failed login attempts"
+}
+
+// verifyCredentials checks an email and password pair, applying the per
+// account and per IP failed attempt limits. Unknown accounts take as long to
+// reject as wrong passwords and produce the same error.
+func (cfg *apiConfig) verifyCredentials(r *http.Request, email, password string) (database.User, error) {
+	accountKey := accountThrottleKey(email)
+	ip := cfg.clientIP(r)
+	if wait := max(cfg.accountThrottle.retryAfter(accountKey), cfg.ipThrottle.retryAfter(ip)); wait > 0 {
+		return database.User{}, &loginThrottledError{retryAfter: wait}
+	}
+
+	user, err := cfg.db.GetUserByEmail(r.Context(), email)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to look up user for login: %v", err)
+		}
+		auth.CheckPasswordHash(password, cfg.dummyPasswordHash)
+		cfg.recordLoginFailure(accountKey, ip)
+		return database.User{}, errInvalidCredentials
+	}
+
+	if err := auth.CheckPasswordHash(password, user.HashedPassword); err != nil {
+		cfg.recordLoginFailure(accountKey, ip)
+		return database.User{}, errInvalidCredentials
+	}
+	// With two-factor authentication the lockout has to keep counting wrong
+	// codes, so it is only cleared once the second factor succeeds
+	if !user.TotpEnabledAt.Valid {
+		cfg.accountThrottle.reset(accountKey)
+	}
+
+	// Upgrade hashes made with an older algorithm or weaker parameters now
+	// that the plaintext password is at hand
+	if cfg.passwordHasher.NeedsRehash(user.HashedPassword) {
+		cfg.rehashPassword(r, user, password)
+	}
+	return user, nil
+}
+
+func (cfg *apiConfig) recordLoginFailure(accountKey, ip string) {
+	cfg.accountThrottle.recordFailure(accountKey)
+	cfg.ipThrottle.recordFailure(ip)
+	if wait := cfg.accountThrottle.retryAfter(accountKey); wait > 0 {
+		log.Printf("Login for %q locked for %v after repeated failures", accountKey, wait)
+	}
+}
+
+func (cfg *apiConfig) respondWithCredentialError(w http.ResponseWriter, err error) {
+	var throttled *loginThrottledError
+	if errors.As(err, &throttled) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(throttled.retryAfter.Seconds())+1))
+		respondWithJson(w, http.StatusTooManyRequests, errorResponse{
+			Error: "Too many failed login attempts, try again later",
+		})
+		return
+	}
+	respondWithJson(w, http.StatusUnauthorized, errorResponse{
+		Error: "Incorrect email or password",
 	})
+}
+
+func (cfg *apiConfig) handlerUnlockAccount(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Invalid user id provided",
+		})
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "User does not exist",
+		})
+		return
+	}
+
+	cfg.accountThrottle.reset(accountThrottleKey(user.Email))
+	log.Printf("Login lockout cleared for user %s by %s", user.ID, claims.UserID)
+	w.WriteHeader(http.StatusNoContent)
+}
 
+func (cfg *apiConfig) rehashPassword(r *http.Request, user database.User, password string) {
+	hashedPassword, err := cfg.passwordHasher.Hash(password)
+	if err != nil {
+		log.Printf("Failed to rehash password for user %s: %v", user.ID, err)
+		return
+	}
+	_, err = cfg.db.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		ID:             user.ID,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		log.Printf("Failed to store rehashed password for user %s: %v", user.ID, err)
+		return
+	}
+	log.Printf("Password hash upgraded for user %s", user.ID)
 }
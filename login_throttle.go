@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// loginThrottle counts failed login attempts per key (an account's email
+// address or a client IP) and locks the key out for exponentially longer
+// periods once it passes a threshold.
+type loginThrottle struct {
+	mu      sync.Mutex
+	entries map[string]*throttleEntry
+
+	// threshold failures are allowed before the first lockout of baseDelay,
+	// which doubles with every further failure up to maxDelay.
+	threshold int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	// forgetAfter is how long a key must stay quiet for its failures to be
+	// forgotten.
+	forgetAfter time.Duration
+
+	now func() time.Time
+}
+
+type throttleEntry struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+func newLoginThrottle(threshold int, baseDelay, maxDelay time.Duration) *loginThrottle {
+	return &loginThrottle{
+		entries:     map[string]*throttleEntry{},
+		threshold:   threshold,
+		baseDelay:   baseDelay,
+		maxDelay:    maxDelay,
+		forgetAfter: 24 * time.Hour,
+		now:         time.Now,
+	}
+}
+
+// retryAfter returns how long key remains locked out, or zero.
+func (t *loginThrottle) retryAfter(key string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry, ok := t.entries[key]
+	if !ok {
+		return 0
+	}
+	return max(entry.lockedUntil.Sub(t.now()), 0)
+}
+
+func (t *loginThrottle) recordFailure(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	entry, ok := t.entries[key]
+	if !ok || now.Sub(entry.lastFailure) > t.forgetAfter {
+		entry = &throttleEntry{}
+		t.entries[key] = entry
+	}
+	entry.failures++
+	entry.lastFailure = now
+
+	if entry.failures >= t.threshold {
+		// Doubling stops at maxDelay, before the duration can overflow
+		delay := t.baseDelay
+		for i := 0; i < entry.failures-t.threshold && delay < t.maxDelay; i++ {
+			delay *= 2
+		}
+		entry.lockedUntil = now.Add(min(delay, t.maxDelay))
+	}
+}
+
+func (t *loginThrottle) reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.entries, key)
+}
+
+// sweep forgets keys that haven't failed for a while.
+func (t *loginThrottle) sweep() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	for key, entry := range t.entries {
+		if now.Sub(entry.lastFailure) > t.forgetAfter && !now.Before(entry.lockedUntil) {
+			delete(t.entries, key)
+		}
+	}
+}
+
+func accountThrottleKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
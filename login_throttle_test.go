@@ -0,0 +1,141 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestLoginThrottleBackoff(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	throttle := newLoginThrottle(3, time.Minute, 5*time.Minute)
+	throttle.now = func() time.Time { return now }
+
+	for range 2 {
+		throttle.recordFailure("user@example.com")
+	}
+	if wait := throttle.retryAfter("user@example.com"); wait != 0 {
+		t.Fatalf("retryAfter() = %v before reaching the threshold", wait)
+	}
+
+	wantDelays := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for _, want := range wantDelays {
+		throttle.recordFailure("user@example.com")
+		if got := throttle.retryAfter("user@example.com"); got != want {
+			t.Errorf("retryAfter() = %v, want %v", got, want)
+		}
+	}
+
+	now = now.Add(5 * time.Minute)
+	if wait := throttle.retryAfter("user@example.com"); wait != 0 {
+		t.Errorf("retryAfter() = %v after the lockout expired", wait)
+	}
+	if wait := throttle.retryAfter("other@example.com"); wait != 0 {
+		t.Errorf("retryAfter() = %v for an unrelated key", wait)
+	}
+}
+
+func TestLoginThrottleManyFailures(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	// The limits used for accounts in main.go
+	throttle := newLoginThrottle(5, 30*time.Second, 15*time.Minute)
+	throttle.now = func() time.Time { return now }
+
+	// A 30s delay shifted left by 29 or more overflows a time.Duration
+	for i := range 1000 {
+		throttle.recordFailure("user@example.com")
+		if i < 4 {
+			continue
+		}
+		if got := throttle.retryAfter("user@example.com"); got <= 0 || got > 15*time.Minute {
+			t.Fatalf("after %d failures retryAfter() = %v, want up to %v", i+1, got, 15*time.Minute)
+		}
+	}
+	if got := throttle.retryAfter("user@example.com"); got != 15*time.Minute {
+		t.Errorf("retryAfter() = %v, want %v", got, 15*time.Minute)
+	}
+}
+
+func TestLoginThrottleResetAndForget(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	throttle := newLoginThrottle(1, time.Minute, time.Hour)
+	throttle.now = func() time.Time { return now }
+
+	throttle.recordFailure("203.0.113.7")
+	throttle.reset("203.0.113.7")
+	if wait := throttle.retryAfter("203.0.113.7"); wait != 0 {
+		t.Errorf("retryAfter() = %v after reset", wait)
+	}
+
+	throttle.recordFailure("203.0.113.8")
+	now = now.Add(throttle.forgetAfter + time.Minute)
+	throttle.sweep()
+	if _, ok := throttle.entries["203.0.113.8"]; ok {
+		t.Errorf("sweep() kept an idle entry")
+	}
+
+	// A failure long after the last one starts counting from scratch
+	throttle.recordFailure("203.0.113.9")
+	now = now.Add(throttle.forgetAfter + time.Minute)
+	throttle.recordFailure("203.0.113.9")
+	if got := throttle.retryAfter("203.0.113.9"); got != time.Minute {
+		t.Errorf("retryAfter() = %v, want %v", got, time.Minute)
+	}
+}
+
+func TestCorrectPasswordOnlyClearsLockoutWithoutTOTP(t *testing.T) {
+	hash, err := testPasswordHasher.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		totp       bool
+		wantLocked bool
+	}{
+		{
+			name:       "Password is the last factor",
+			totp:       false,
+			wantLocked: false,
+		},
+		{
+			name:       "Two-factor code still to come",
+			totp:       true,
+			wantLocked: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, mock := newMockConfig(t)
+			cfg.passwordHasher = testPasswordHasher
+			cfg.accountThrottle = newLoginThrottle(3, time.Minute, time.Hour)
+			cfg.ipThrottle = newLoginThrottle(100, time.Minute, time.Hour)
+
+			user := database.User{ID: uuid.New(), Email: "walt@example.com", HashedPassword: hash}
+			if test.totp {
+				user.TotpEnabledAt = sql.NullTime{Time: time.Now(), Valid: true}
+			}
+			mock.ExpectQuery(queryName("GetUserByEmail")).WillReturnRows(mockUserRows(user))
+
+			// Two wrong codes so far, one short of the lockout
+			key := accountThrottleKey(user.Email)
+			cfg.accountThrottle.recordFailure(key)
+			cfg.accountThrottle.recordFailure(key)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+			if _, err := cfg.verifyCredentials(req, user.Email, "correct horse"); err != nil {
+				t.Fatalf("verifyCredentials() error = %v", err)
+			}
+
+			cfg.accountThrottle.recordFailure(key)
+			if locked := cfg.accountThrottle.retryAfter(key) > 0; locked != test.wantLocked {
+				t.Errorf("locked after another wrong code = %v, want %v", locked, test.wantLocked)
+			}
+		})
+	}
+}
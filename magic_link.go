@@ -0,0 +1,179 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/JakeBurrell/chirpy/internal/mail"
+)
+
+func newMagicLinkMessage(baseURL, address, token string) mail.Message {
+	link := fmt.Sprintf("%s/api/login/magic/verify?token=%s", baseURL, url.QueryEscape(token))
+	return mail.Message{
+		To:      address,
+		Subject: "Your Chirpy login link",
+		Body: fmt.Sprintf(
+			"Someone asked to log in to your Chirpy account without a password.\n\n"+
+				"Follow this link within the next 15 minutes to log in. It only works once:\n\n%s\n\n"+
+				"If this wasn't you, you can ignore this email.\n",
+			link,
+		),
+	}
+}
+
+// handlerRequestMagicLink emails a single-use login token. Requests are
+// limited per address whether or not it belongs to an account.
+func (cfg *apiConfig) handlerRequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	type requestParams struct {
+		Email string `json:"email"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := requestParams{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "Couldn't decode parameters",
+		})
+		return
+	}
+
+	emailKey := accountThrottleKey(params.Email)
+	if wait := max(cfg.magicLinkThrottle.retryAfter(emailKey), cfg.ipThrottle.retryAfter(cfg.clientIP(r))); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		respondWithJson(w, http.StatusTooManyRequests, errorResponse{
+			Error: "Too many login links requested, try again later",
+		})
+		return
+	}
+	cfg.magicLinkThrottle.recordFailure(emailKey)
+
+	// Respond identically whether or not the account exists
+	user, err := cfg.db.GetUserByEmail(r.Context(), params.Email)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to look up user for magic link: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	token, err := auth.MakeOpaqueToken()
+	if err != nil {
+		log.Printf("Failed to create magic link token: %v", err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	err = cfg.db.CreateMagicLinkToken(r.Context(), database.CreateMagicLinkTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+	})
+	if err != nil {
+		log.Printf("Failed to store magic link token: %v", err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	cfg.sendMailAsync(newMagicLinkMessage(cfg.baseURL, user.Email, token))
+	log.Printf("Magic link requested for user %s", user.ID)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handlerVerifyMagicLink exchanges a magic link token for a session, or for
+// an mfa token when the account has two-factor authentication enabled.
+func (cfg *apiConfig) handlerVerifyMagicLink(w http.ResponseWriter, r *http.Request) {
+	type requestParams struct {
+		Token      string `json:"token"`
+		UseCookies bool   `json:"use_cookies"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := requestParams{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "Couldn't decode parameters",
+		})
+		return
+	}
+
+	cfg.verifyMagicLink(w, r, params.Token, params.UseCookies)
+}
+
+// handlerFollowMagicLink logs in from the link in the email. A browser
+// following it keeps the session in cookies.
+func (cfg *apiConfig) handlerFollowMagicLink(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "No token provided",
+		})
+		return
+	}
+
+	cfg.verifyMagicLink(w, r, token, true)
+}
+
+func (cfg *apiConfig) verifyMagicLink(w http.ResponseWriter, r *http.Request, token string, useCookies bool) {
+	tx, err := cfg.sqlDB.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Failed to begin transaction: %v", err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	userID, err := qtx.UseMagicLinkToken(r.Context(), auth.HashToken(token))
+	if err != nil {
+		respondWithJson(w, http.StatusUnauthorized, errorResponse{
+			Error: "Invalid or expired token",
+		})
+		return
+	}
+
+	user, err := qtx.GetUserByID(r.Context(), userID)
+	if err == nil {
+		err = qtx.InvalidateMagicLinkTokens(r.Context(), userID)
+	}
+	// Following the link proves the address belongs to the user
+	if err == nil && !user.EmailVerifiedAt.Valid {
+		err = qtx.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{
+			ID:    user.ID,
+			Email: user.Email,
+		})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Failed to complete magic link login for user %s: %v", userID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	if !user.TotpEnabledAt.Valid {
+		cfg.accountThrottle.reset(accountThrottleKey(user.Email))
+	}
+	cfg.magicLinkThrottle.reset(accountThrottleKey(user.Email))
+	cfg.respondWithFirstFactor(w, r, user, useCookies)
+}
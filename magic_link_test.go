@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/mail"
+)
+
+func TestMagicLinkMessage(t *testing.T) {
+	dir := t.TempDir()
+	mailer := &mail.FileMailer{Dir: dir, From: "chirpy@example.com"}
+
+	err := mailer.Send(context.Background(), newMagicLinkMessage("https://chirpy.example.com", "user@example.com", "abc+123/"))
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("expected 1 message file, got %d", len(files))
+	}
+	data, _ := os.ReadFile(files[0])
+	for _, want := range []string{
+		"To: user@example.com\r\n",
+		"https://chirpy.example.com/api/login/magic/verify?token=abc%2B123%2F",
+		"15 minutes",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("message missing %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestMagicLinkThrottleIsPerAddress(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	throttle := newLoginThrottle(3, time.Minute, time.Hour)
+	throttle.now = func() time.Time { return now }
+
+	// Addresses differing only in case or whitespace share a limit
+	for _, email := range []string{"user@example.com", "User@Example.com", " user@example.com"} {
+		if wait := throttle.retryAfter(accountThrottleKey(email)); wait != 0 {
+			t.Fatalf("retryAfter() = %v before reaching the limit", wait)
+		}
+		throttle.recordFailure(accountThrottleKey(email))
+	}
+	if wait := throttle.retryAfter(accountThrottleKey("user@example.com")); wait != time.Minute {
+		t.Errorf("retryAfter() = %v, want %v", wait, time.Minute)
+	}
+	if wait := throttle.retryAfter(accountThrottleKey("other@example.com")); wait != 0 {
+		t.Errorf("retryAfter() = %v for another address", wait)
+	}
+}
+
+func TestFollowMagicLink(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	cfg.baseURL = "https://chirpy.example.com"
+	token := "abc+123/"
+
+	var link string
+	for _, line := range strings.Split(newMagicLinkMessage(cfg.baseURL, "user@example.com", token).Body, "\n") {
+		if strings.HasPrefix(line, cfg.baseURL) {
+			link = line
+		}
+	}
+	if link == "" {
+		t.Fatal("message has no link")
+	}
+
+	// The token reaches the lookup unchanged after escaping
+	mock.ExpectBegin()
+	mock.ExpectQuery(queryName("UseMagicLinkToken")).
+		WithArgs(auth.HashToken(token)).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	rec := httptest.NewRecorder()
+	cfg.routes(t.TempDir()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, link, nil))
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusUnauthorized, rec.Body)
+	}
+}
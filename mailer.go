@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/JakeBurrell/chirpy/internal/mail"
+)
+
+// loadMailer picks the mail transport from the environment: SMTP when
+// SMTP_HOST is set, .eml files in MAIL_DIR for local development, and the
+// log otherwise.
+func loadMailer() (mail.Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Chirpy <no-reply@chirpy.local>"
+	}
+
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port := 587
+		if portStr := os.Getenv("SMTP_PORT"); portStr != "" {
+			var err error
+			port, err = strconv.Atoi(portStr)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return &mail.SMTPMailer{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}, nil
+	}
+
+	if dir := os.Getenv("MAIL_DIR"); dir != "" {
+		return &mail.FileMailer{Dir: dir, From: from}, nil
+	}
+
+	return mail.LogMailer{}, nil
+}
+
+// sendMailAsync delivers mail in the background so response times don't
+// reveal whether an address belongs to an account.
+func (cfg *apiConfig) sendMailAsync(msg mail.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := cfg.mailer.Send(ctx, msg); err != nil {
+			log.Printf("Failed to send mail to %s: %v", msg.To, err)
+		}
+	}()
+}
@@ -1,21 +1,42 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"github.com/JakeBurrell/chirpy/internal/auth"
 	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/JakeBurrell/chirpy/internal/mail"
+	"github.com/JakeBurrell/chirpy/internal/oidc"
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"sync/atomic"
+	"time"
 )
 
 type apiConfig struct {
-	fileserverHits atomic.Int32
-	db             *database.Queries
-	platform       string
-	secret         string
+	fileserverHits       atomic.Int32
+	db                   *database.Queries
+	sqlDB                *sql.DB
+	platform             string
+	jwtKeys              *auth.KeySet
+	polkaKey             string
+	mailer               mail.Mailer
+	baseURL              string
+	requireVerifiedEmail bool
+	trustProxyHeaders    bool
+	revocations          *revocationCache
+	passwordHasher       auth.PasswordHasher
+	passwordPolicy       auth.PasswordPolicy
+	dummyPasswordHash    string
+	accountThrottle      *loginThrottle
+	ipThrottle           *loginThrottle
+	magicLinkThrottle    *loginThrottle
+	oidcProvider         *oidc.Provider
 }
 
 func main() {
@@ -26,7 +47,13 @@ func main() {
 	godotenv.Load()
 	dbURL := os.Getenv("DB_URL")
 	platformEnv := os.Getenv("PLATFORM")
-	secretEnv := os.Getenv("SECRET")
+	polkaKeyEnv := os.Getenv("POLKA_KEY")
+	baseURLEnv := os.Getenv("BASE_URL")
+	if baseURLEnv == "" {
+		baseURLEnv = "http://localhost:" + port
+	}
+	requireVerifiedEmailEnv := os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true"
+	trustProxyHeadersEnv := os.Getenv("TRUST_PROXY_HEADERS") == "true"
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
 		log.Fatalf("Error connecting to the database: %v", err)
@@ -34,13 +61,83 @@ func main() {
 
 	dbQueries := database.New(db)
 
+	jwtKeys, err := loadJWTKeys()
+	if err != nil {
+		log.Fatalf("Error loading JWT keys: %v", err)
+	}
+
+	mailer, err := loadMailer()
+	if err != nil {
+		log.Fatalf("Error configuring mailer: %v", err)
+	}
+
+	passwordHasher, err := loadPasswordHasher()
+	if err != nil {
+		log.Fatalf("Error configuring password hashing: %v", err)
+	}
+
+	passwordPolicy, err := loadPasswordPolicy()
+	if err != nil {
+		log.Fatalf("Error configuring password policy: %v", err)
+	}
+
+	oidcProvider, err := loadOIDCProvider(strings.TrimSuffix(baseURLEnv, "/"))
+	if err != nil {
+		log.Fatalf("Error configuring single sign-on: %v", err)
+	}
+
+	// Compared against when a login names an unknown account
+	dummyPasswordHash, err := passwordHasher.Hash(uuid.NewString())
+	if err != nil {
+		log.Fatalf("Error hashing dummy password: %v", err)
+	}
+
 	cfg := apiConfig{
-		fileserverHits: atomic.Int32{},
-		db:             dbQueries,
-		platform:       platformEnv,
-		secret:         secretEnv,
+		fileserverHits:       atomic.Int32{},
+		db:                   dbQueries,
+		sqlDB:                db,
+		platform:             platformEnv,
+		jwtKeys:              jwtKeys,
+		polkaKey:             polkaKeyEnv,
+		mailer:               mailer,
+		baseURL:              strings.TrimSuffix(baseURLEnv, "/"),
+		requireVerifiedEmail: requireVerifiedEmailEnv,
+		trustProxyHeaders:    trustProxyHeadersEnv,
+		revocations:          newRevocationCache(),
+		passwordHasher:       passwordHasher,
+		passwordPolicy:       passwordPolicy,
+		dummyPasswordHash:    dummyPasswordHash,
+		accountThrottle:      newLoginThrottle(5, 30*time.Second, 15*time.Minute),
+		ipThrottle:           newLoginThrottle(20, 30*time.Second, time.Hour),
+		magicLinkThrottle:    newLoginThrottle(3, time.Minute, time.Hour),
+		oidcProvider:         oidcProvider,
+	}
+
+	if err := cfg.bootstrapAdmin(context.Background()); err != nil {
+		log.Printf("Failed to bootstrap admin: %v", err)
 	}
 
+	go func() {
+		for range time.Tick(time.Minute) {
+			cfg.revocations.sweep()
+			cfg.accountThrottle.sweep()
+			cfg.ipThrottle.sweep()
+			cfg.magicLinkThrottle.sweep()
+		}
+	}()
+
+	server := &http.Server{
+		Addr:    ":" + port,
+		Handler: cfg.routes(filepathRoot),
+	}
+
+	log.Printf("Serving files from %s on port: %s\n", filepathRoot, port)
+	log.Fatal(server.ListenAndServe())
+}
+
+// routes registers every endpoint, serving the app's static files from
+// filepathRoot.
+func (cfg *apiConfig) routes(filepathRoot string) *http.ServeMux {
 	mux := http.NewServeMux()
 	mux.Handle(
 		"/app/",
@@ -50,23 +147,62 @@ func main() {
 		),
 	)
 	mux.HandleFunc("GET /api/healthz", handlerHealthz)
-	mux.HandleFunc("GET /admin/metrics", cfg.handlerMetrics)
-	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
+	mux.HandleFunc("GET /.well-known/jwks.json", cfg.handlerJWKS)
+	mux.HandleFunc("GET /admin/metrics", cfg.requireScopes(cfg.handlerMetrics, auth.ScopeUsersAdmin))
+	mux.HandleFunc("POST /admin/reset", cfg.requireScopes(cfg.handlerReset, auth.ScopeUsersAdmin))
+	mux.HandleFunc("POST /admin/users/{userID}/unlock", cfg.requireScopes(cfg.handlerUnlockAccount, auth.ScopeUsersAdmin))
+	mux.HandleFunc("PUT /admin/users/{userID}/role", cfg.requireScopes(cfg.handlerSetUserRole, auth.ScopeUsersAdmin))
+	mux.HandleFunc("POST /admin/users/{userID}/revoke-sessions", cfg.requireScopes(cfg.handlerRevokeUserSessions, auth.ScopeUsersAdmin))
+	mux.HandleFunc("PUT /admin/oauth/clients/{clientID}/introspection", cfg.requireScopes(cfg.handlerSetOAuthClientIntrospection, auth.ScopeUsersAdmin))
 	mux.HandleFunc("POST /api/users", cfg.handlerCreateUser)
-	mux.HandleFunc("POST /api/chirps", cfg.handlerCreateChirps)
+	mux.HandleFunc("POST /api/chirps", cfg.requireScopes(cfg.handlerCreateChirps, auth.ScopeChirpsWrite))
 	mux.HandleFunc("POST /api/login", cfg.handleLogin)
+	mux.HandleFunc("POST /api/login/2fa", cfg.handleLoginTOTP)
+	mux.HandleFunc("POST /api/login/magic", cfg.handlerRequestMagicLink)
+	mux.HandleFunc("POST /api/login/magic/verify", cfg.handlerVerifyMagicLink)
+	mux.HandleFunc("GET /api/login/magic/verify", cfg.handlerFollowMagicLink)
+	mux.HandleFunc("GET /api/login/oidc", cfg.handlerOIDCLogin)
+	mux.HandleFunc("GET /api/login/oidc/callback", cfg.handlerOIDCCallback)
+	mux.HandleFunc("POST /api/2fa/enroll", cfg.requireScopes(cfg.handlerEnrollTOTP, auth.ScopeAccount))
+	mux.HandleFunc("POST /api/2fa/verify", cfg.requireScopes(cfg.handlerVerifyTOTP, auth.ScopeAccount))
 	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
 	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
-	mux.HandleFunc("GET /api/chirps", cfg.handlerAllChirps)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.handlerGetChirp)
-	mux.HandleFunc("PUT /api/users", cfg.handlerUpdateUser)
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.handlerDeleteChirps)
+	mux.HandleFunc("POST /api/keys", cfg.requireScopes(cfg.handlerCreateAPIKey, auth.ScopeAccount))
+	mux.HandleFunc("GET /api/keys", cfg.requireScopes(cfg.handlerListAPIKeys, auth.ScopeAccount))
+	mux.HandleFunc("DELETE /api/keys/{keyID}", cfg.requireScopes(cfg.handlerRevokeAPIKey, auth.ScopeAccount))
+	mux.HandleFunc("POST /api/oauth/clients", cfg.requireScopes(cfg.handlerCreateOAuthClient, auth.ScopeAccount))
+	mux.HandleFunc("GET /api/oauth/clients", cfg.requireScopes(cfg.handlerListOAuthClients, auth.ScopeAccount))
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientID}", cfg.requireScopes(cfg.handlerDeleteOAuthClient, auth.ScopeAccount))
+	mux.HandleFunc("GET /oauth/authorize", cfg.handlerOAuthAuthorize)
+	mux.HandleFunc("POST /oauth/authorize", cfg.handlerOAuthConsent)
+	mux.HandleFunc("POST /oauth/token", cfg.handlerOAuthToken)
+	mux.HandleFunc("POST /api/token/introspect", cfg.handlerIntrospectToken)
+	mux.HandleFunc("GET /api/me", cfg.requireScopes(cfg.handlerMe, auth.ScopeUsersRead))
+	mux.HandleFunc("GET /api/sessions", cfg.requireScopes(cfg.handlerListSessions, auth.ScopeAccount))
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", cfg.requireScopes(cfg.handlerRevokeSession, auth.ScopeAccount))
+	mux.HandleFunc("POST /api/logout", cfg.requireScopes(cfg.handlerLogout))
+	mux.HandleFunc("POST /api/logout-all", cfg.requireScopes(cfg.handlerLogoutAll, auth.ScopeAccount))
+	mux.HandleFunc("GET /api/chirps", cfg.allowAnonymous(cfg.handlerAllChirps, auth.ScopeChirpsRead))
+	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.allowAnonymous(cfg.handlerGetChirp, auth.ScopeChirpsRead))
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", cfg.requireScopes(cfg.handlerUpdateChirp, auth.ScopeChirpsWrite))
+	mux.HandleFunc("GET /api/chirps/{chirpID}/revisions", cfg.allowAnonymous(cfg.handlerChirpRevisions, auth.ScopeChirpsRead))
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", cfg.allowAnonymous(cfg.handlerChirpThread, auth.ScopeChirpsRead))
+	mux.HandleFunc("PUT /api/chirps/{chirpID}/like", cfg.requireScopes(cfg.handlerLikeChirp, auth.ScopeChirpsWrite))
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/like", cfg.requireScopes(cfg.handlerUnlikeChirp, auth.ScopeChirpsWrite))
+	mux.HandleFunc("PUT /api/chirps/{chirpID}/rechirp", cfg.requireScopes(cfg.handlerRechirp, auth.ScopeChirpsWrite))
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/rechirp", cfg.requireScopes(cfg.handlerUndoRechirp, auth.ScopeChirpsWrite))
+	mux.HandleFunc("GET /api/users/{userID}", cfg.allowAnonymous(cfg.handlerUserProfile, auth.ScopeUsersRead))
+	mux.HandleFunc("GET /api/users/{userID}/likes", cfg.allowAnonymous(cfg.handlerUserLikes, auth.ScopeChirpsRead))
+	mux.HandleFunc("PUT /api/users/{userID}/follow", cfg.requireScopes(cfg.handlerFollowUser, auth.ScopeUsersWrite))
+	mux.HandleFunc("DELETE /api/users/{userID}/follow", cfg.requireScopes(cfg.handlerUnfollowUser, auth.ScopeUsersWrite))
+	mux.HandleFunc("GET /api/users/{userID}/followers", cfg.allowAnonymous(cfg.handlerFollowers, auth.ScopeUsersRead))
+	mux.HandleFunc("GET /api/users/{userID}/following", cfg.allowAnonymous(cfg.handlerFollowing, auth.ScopeUsersRead))
+	mux.HandleFunc("PUT /api/users", cfg.requireScopes(cfg.handlerUpdateUser, auth.ScopeUsersWrite, auth.ScopeAccount))
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.requireScopes(cfg.handlerDeleteChirps, auth.ScopeChirpsWrite))
+	mux.HandleFunc("POST /api/polka/webhooks", cfg.handlerPolkaWebhook)
+	mux.HandleFunc("POST /api/password-reset", cfg.handlerRequestPasswordReset)
+	mux.HandleFunc("POST /api/password-reset/confirm", cfg.handlerConfirmPasswordReset)
+	mux.HandleFunc("GET /api/verify-email", cfg.handlerVerifyEmail)
 
-	server := &http.Server{
-		Addr:    ":" + port,
-		Handler: mux,
-	}
-
-	log.Printf("Serving files from %s on port: %s\n", filepathRoot, port)
-	log.Fatal(server.ListenAndServe())
+	return mux
 }
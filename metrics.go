@@ -3,9 +3,11 @@ package main
 import (
 	"fmt"
 	"net/http"
+
+	"github.com/JakeBurrell/chirpy/internal/auth"
 )
 
-func (cfg *apiConfig) handlerMetrics(w http.ResponseWriter, r *http.Request) {
+func (cfg *apiConfig) handlerMetrics(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
 	const metricsPage = `
 <html>
   <body>
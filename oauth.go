@@ -0,0 +1,436 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const oauthAccessTokenLifetime = time.Hour
+
+// Scopes granted when an authorization request doesn't name any
+var defaultOAuthScopes = []string{auth.ScopeChirpsRead, auth.ScopeUsersRead}
+
+// oauthError is an error response defined by RFC 6749.
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *oauthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// authorizeRequest is a validated request to /oauth/authorize.
+type authorizeRequest struct {
+	Client        database.OauthClient
+	RedirectURI   string
+	Scopes        []string
+	State         string
+	CodeChallenge string
+}
+
+// parseAuthorizeRequest validates the parameters of an authorization request.
+// Problems with the client or redirect URI can't safely be reported to the
+// redirect URI, so they come back as redirectErr == nil.
+func (cfg *apiConfig) parseAuthorizeRequest(r *http.Request, values url.Values) (req authorizeRequest, redirectErr *oauthError, err error) {
+	clientID, err := uuid.Parse(values.Get("client_id"))
+	if err != nil {
+		return req, nil, errors.New("Unknown client")
+	}
+	req.Client, err = cfg.db.GetOAuthClient(r.Context(), clientID)
+	if err != nil {
+		return req, nil, errors.New("Unknown client")
+	}
+
+	registered := strings.Fields(req.Client.RedirectUris)
+	req.RedirectURI = values.Get("redirect_uri")
+	if req.RedirectURI == "" && len(registered) == 1 {
+		req.RedirectURI = registered[0]
+	}
+	if !slices.Contains(registered, req.RedirectURI) {
+		return req, nil, errors.New("Redirect URI is not registered for this client")
+	}
+
+	req.State = values.Get("state")
+	if values.Get("response_type") != "code" {
+		return req, &oauthError{Code: "unsupported_response_type"}, nil
+	}
+
+	// PKCE is required for every client
+	req.CodeChallenge = values.Get("code_challenge")
+	if values.Get("code_challenge_method") != "S256" || !auth.ValidPKCEChallenge(req.CodeChallenge) {
+		return req, &oauthError{
+			Code:        "invalid_request",
+			Description: "An S256 code_challenge is required",
+		}, nil
+	}
+
+	req.Scopes = auth.SplitScopes(values.Get("scope"))
+	if len(req.Scopes) == 0 {
+		req.Scopes = defaultOAuthScopes
+	}
+	for _, scope := range req.Scopes {
+		if _, ok := auth.OAuthScopes[scope]; !ok {
+			return req, &oauthError{
+				Code:        "invalid_scope",
+				Description: "Unknown scope " + scope,
+			}, nil
+		}
+	}
+	req.Scopes = slices.Compact(slices.Sorted(slices.Values(req.Scopes)))
+	return req, nil, nil
+}
+
+// redirectWith sends the user agent back to the client with the given
+// parameters added to its redirect URI.
+func (req authorizeRequest) redirectWith(w http.ResponseWriter, r *http.Request, params url.Values) {
+	target, _ := url.Parse(req.RedirectURI)
+	query := target.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func (req authorizeRequest) redirectError(w http.ResponseWriter, r *http.Request, oauthErr *oauthError) {
+	params := url.Values{"error": {oauthErr.Code}}
+	if oauthErr.Description != "" {
+		params.Set("error_description", oauthErr.Description)
+	}
+	req.redirectWith(w, r, params)
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+  <head><title>Authorize {{.ClientName}}</title></head>
+  <body>
+    <h1>{{.ClientName}} wants to access your Chirpy account</h1>
+    {{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+    <p>It will be able to:</p>
+    <ul>
+      {{range .Scopes}}<li>{{.}}</li>{{end}}
+    </ul>
+    <form method="post" action="/oauth/authorize">
+      {{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+      {{end}}
+      <label>Email <input type="email" name="email" value="{{.Email}}" required></label>
+      <label>Password <input type="password" name="password" required></label>
+      <label>Two-factor code (if enabled) <input type="text" name="totp_code" autocomplete="one-time-code"></label>
+      <button type="submit" name="decision" value="allow">Allow</button>
+      <button type="submit" name="decision" value="deny" formnovalidate>Deny</button>
+    </form>
+  </body>
+</html>
+`))
+
+var consentParams = []string{"response_type", "client_id", "redirect_uri", "scope", "state", "code_challenge", "code_challenge_method"}
+
+func renderConsentPage(w http.ResponseWriter, code int, req authorizeRequest, values url.Values, email, errorMessage string) {
+	data := struct {
+		ClientName string
+		Scopes     []string
+		Params     map[string]string
+		Email      string
+		Error      string
+	}{
+		ClientName: req.Client.Name,
+		Params:     map[string]string{},
+		Email:      email,
+		Error:      errorMessage,
+	}
+	for _, scope := range req.Scopes {
+		data.Scopes = append(data.Scopes, auth.OAuthScopes[scope])
+	}
+	for _, name := range consentParams {
+		data.Params[name] = values.Get(name)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// The consent page must not be framed by the client asking for consent
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.WriteHeader(code)
+	if err := consentTemplate.Execute(w, data); err != nil {
+		log.Printf("Failed to render consent page: %v", err)
+	}
+}
+
+func (cfg *apiConfig) handlerOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	req, redirectErr, err := cfg.parseAuthorizeRequest(r, values)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if redirectErr != nil {
+		req.redirectError(w, r, redirectErr)
+		return
+	}
+	renderConsentPage(w, http.StatusOK, req, values, "", "")
+}
+
+func (cfg *apiConfig) handlerOAuthConsent(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	values := r.PostForm
+	req, redirectErr, err := cfg.parseAuthorizeRequest(r, values)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if redirectErr != nil {
+		req.redirectError(w, r, redirectErr)
+		return
+	}
+
+	if values.Get("decision") != "allow" {
+		req.redirectError(w, r, &oauthError{Code: "access_denied"})
+		return
+	}
+
+	email := values.Get("email")
+	user, err := cfg.verifyCredentials(r, email, values.Get("password"))
+	if err != nil {
+		var throttled *loginThrottledError
+		if errors.As(err, &throttled) {
+			renderConsentPage(w, http.StatusTooManyRequests, req, values, email, "Too many failed login attempts, try again later")
+			return
+		}
+		renderConsentPage(w, http.StatusUnauthorized, req, values, email, "Incorrect email or password")
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		if !cfg.verifySecondFactor(r.Context(), user, values.Get("totp_code"), "") {
+			cfg.recordLoginFailure(accountThrottleKey(user.Email), cfg.clientIP(r))
+			renderConsentPage(w, http.StatusUnauthorized, req, values, email, "Invalid two-factor code")
+			return
+		}
+		cfg.accountThrottle.reset(accountThrottleKey(user.Email))
+	}
+
+	// The code keeps the redirect URI as the client sent it. It stays empty
+	// when the client relied on its only registered URI, so the token request
+	// doesn't have to repeat it.
+	code, err := auth.MakeOpaqueToken()
+	if err == nil {
+		err = cfg.db.CreateOAuthAuthorizationCode(r.Context(), database.CreateOAuthAuthorizationCodeParams{
+			CodeHash:      auth.HashToken(code),
+			ClientID:      req.Client.ID,
+			UserID:        user.ID,
+			RedirectUri:   values.Get("redirect_uri"),
+			Scopes:        auth.JoinScopes(req.Scopes),
+			CodeChallenge: req.CodeChallenge,
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to create authorization code: %v", err)
+		req.redirectError(w, r, &oauthError{Code: "server_error"})
+		return
+	}
+
+	log.Printf("User %s authorized oauth client %s for %v", user.ID, req.Client.ID, req.Scopes)
+	req.redirectWith(w, r, url.Values{"code": {code}})
+}
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+func respondWithOAuthError(w http.ResponseWriter, code int, oauthErr *oauthError) {
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJson(w, code, oauthErr)
+}
+
+// authenticateOAuthClient identifies the client calling the token endpoint.
+// Confidential clients authenticate with HTTP Basic or client_secret in the
+// form body; public clients only send their client_id.
+func (cfg *apiConfig) authenticateOAuthClient(r *http.Request) (database.OauthClient, error) {
+	clientIDStr, secret, basic := r.BasicAuth()
+	if basic {
+		clientIDStr, _ = url.QueryUnescape(clientIDStr)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientIDStr = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	clientID, err := uuid.Parse(clientIDStr)
+	if err != nil {
+		return database.OauthClient{}, errors.New("unknown client")
+	}
+	client, err := cfg.db.GetOAuthClient(r.Context(), clientID)
+	if err != nil {
+		return database.OauthClient{}, errors.New("unknown client")
+	}
+
+	if !client.SecretHash.Valid {
+		if secret != "" {
+			return database.OauthClient{}, errors.New("public clients have no secret")
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash.String)) != 1 {
+		return database.OauthClient{}, errors.New("invalid client secret")
+	}
+	return client, nil
+}
+
+func (cfg *apiConfig) handlerOAuthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, &oauthError{Code: "invalid_request"})
+		return
+	}
+
+	client, err := cfg.authenticateOAuthClient(r)
+	if err != nil {
+		if _, _, basic := r.BasicAuth(); basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+		}
+		respondWithOAuthError(w, http.StatusUnauthorized, &oauthError{
+			Code:        "invalid_client",
+			Description: err.Error(),
+		})
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		cfg.handleAuthorizationCodeGrant(w, r, client)
+	case "refresh_token":
+		cfg.handleRefreshTokenGrant(w, r, client)
+	default:
+		respondWithOAuthError(w, http.StatusBadRequest, &oauthError{Code: "unsupported_grant_type"})
+	}
+}
+
+func (cfg *apiConfig) handleAuthorizationCodeGrant(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	invalidGrant := &oauthError{
+		Code:        "invalid_grant",
+		Description: "Invalid, expired or already used authorization code",
+	}
+
+	code, err := cfg.db.UseOAuthAuthorizationCode(r.Context(), auth.HashToken(r.PostForm.Get("code")))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to redeem authorization code: %v", err)
+		}
+		respondWithOAuthError(w, http.StatusBadRequest, invalidGrant)
+		return
+	}
+	// The redirect URI only has to match when the authorization request
+	// included one (RFC 6749 section 4.1.3)
+	if code.ClientID != client.ID || (code.RedirectUri != "" && code.RedirectUri != r.PostForm.Get("redirect_uri")) {
+		respondWithOAuthError(w, http.StatusBadRequest, invalidGrant)
+		return
+	}
+	if !auth.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+		respondWithOAuthError(w, http.StatusBadRequest, &oauthError{
+			Code:        "invalid_grant",
+			Description: "code_verifier does not match the code challenge",
+		})
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), code.UserID)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, invalidGrant)
+		return
+	}
+
+	refreshToken, err := cfg.createRefreshToken(r, cfg.db, refreshTokenFamily{
+		UserID:   user.ID,
+		FamilyID: uuid.New(),
+		ClientID: uuid.NullUUID{UUID: client.ID, Valid: true},
+		Scopes:   sql.NullString{String: code.Scopes, Valid: true},
+	})
+	if err != nil {
+		log.Printf("failed to create refresh token: %v", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, &oauthError{Code: "server_error"})
+		return
+	}
+	cfg.respondWithOAuthTokens(w, user, auth.SplitScopes(code.Scopes), refreshToken)
+}
+
+func (cfg *apiConfig) handleRefreshTokenGrant(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	refreshToken, current, err := cfg.rotateRefreshToken(r, r.PostForm.Get("refresh_token"), uuid.NullUUID{UUID: client.ID, Valid: true})
+	if err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, &oauthError{
+			Code:        "invalid_grant",
+			Description: "Invalid or expired refresh token",
+		})
+		return
+	}
+
+	// A refresh may ask for fewer scopes than were granted, never more
+	scopes := auth.SplitScopes(current.Scopes.String)
+	if requested := auth.SplitScopes(r.PostForm.Get("scope")); len(requested) > 0 {
+		for _, scope := range requested {
+			if !slices.Contains(scopes, scope) {
+				respondWithOAuthError(w, http.StatusBadRequest, &oauthError{
+					Code:        "invalid_scope",
+					Description: "Scope " + scope + " was not granted",
+				})
+				return
+			}
+		}
+		scopes = requested
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), current.UserID)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, &oauthError{Code: "invalid_grant"})
+		return
+	}
+	cfg.respondWithOAuthTokens(w, user, scopes, refreshToken)
+}
+
+// respondWithOAuthTokens issues an access token limited to the granted scopes
+// the user's role still allows.
+func (cfg *apiConfig) respondWithOAuthTokens(w http.ResponseWriter, user database.User, granted []string, refreshToken string) {
+	role := auth.Role(user.Role)
+	scopes := []string{}
+	for _, scope := range granted {
+		if slices.Contains(role.Scopes(), scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	accessToken, err := auth.MakeJWT(user.ID, role, scopes, cfg.jwtKeys, oauthAccessTokenLifetime)
+	if err != nil {
+		log.Printf("failed to create jwt token: %v", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, &oauthError{Code: "server_error"})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJson(w, http.StatusOK, oauthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessTokenLifetime.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        auth.JoinScopes(scopes),
+	})
+}
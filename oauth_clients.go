@@ -0,0 +1,237 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxRedirectURIs = 10
+
+type oauthClientJson struct {
+	ClientID     uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Confidential bool      `json:"confidential"`
+	// CanIntrospect is set by an admin for trusted resource servers
+	CanIntrospect bool      `json:"can_introspect"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type createdOAuthClientJson struct {
+	oauthClientJson
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+func newOAuthClientJson(client database.OauthClient) oauthClientJson {
+	return oauthClientJson{
+		ClientID:      client.ID,
+		Name:          client.Name,
+		RedirectURIs:  strings.Fields(client.RedirectUris),
+		Confidential:  client.SecretHash.Valid,
+		CanIntrospect: client.CanIntrospect,
+		CreatedAt:     client.CreatedAt,
+	}
+}
+
+// validateRedirectURI accepts absolute URIs without fragments. Plain http is
+// only allowed for loopback addresses; native apps may use a private scheme.
+func validateRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() || strings.ContainsAny(raw, " \t\n") {
+		return errors.New("redirect uris must be absolute")
+	}
+	if u.Fragment != "" {
+		return errors.New("redirect uris must not contain a fragment")
+	}
+	switch u.Scheme {
+	case "https":
+	case "http":
+		host := u.Hostname()
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return errors.New("http redirect uris are only allowed for loopback addresses")
+		}
+	case "javascript", "data", "file":
+		return errors.New("redirect uri scheme is not allowed")
+	}
+	return nil
+}
+
+func (cfg *apiConfig) handlerCreateOAuthClient(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	type requestParams struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Confidential bool     `json:"confidential"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := requestParams{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "Couldn't decode parameters",
+		})
+		return
+	}
+
+	if params.Name == "" || len(params.Name) > 100 {
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "name must be between 1 and 100 characters",
+		})
+		return
+	}
+	if len(params.RedirectURIs) == 0 || len(params.RedirectURIs) > maxRedirectURIs {
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "Between 1 and 10 redirect uris are required",
+		})
+		return
+	}
+	for _, redirectURI := range params.RedirectURIs {
+		if err := validateRedirectURI(redirectURI); err != nil {
+			respondWithJson(w, http.StatusBadRequest, errorResponse{
+				Error: err.Error(),
+			})
+			return
+		}
+	}
+
+	secret := ""
+	secretHash := sql.NullString{}
+	if params.Confidential {
+		secret, err = auth.MakeOpaqueToken()
+		if err != nil {
+			log.Printf("Failed to generate client secret: %v", err)
+			respondWithJson(w, http.StatusInternalServerError, errorResponse{
+				Error: "Something went wrong",
+			})
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	client, err := cfg.db.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		Name:         params.Name,
+		SecretHash:   secretHash,
+		RedirectUris: strings.Join(params.RedirectURIs, " "),
+		UserID:       claims.UserID,
+	})
+	if err != nil {
+		log.Printf("Failed to create oauth client for user %s: %v", claims.UserID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	log.Printf("OAuth client %s registered by user %s", client.ID, claims.UserID)
+	respondWithJson(w, http.StatusCreated, createdOAuthClientJson{
+		oauthClientJson: newOAuthClientJson(client),
+		ClientSecret:    secret,
+	})
+}
+
+func (cfg *apiConfig) handlerListOAuthClients(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	clients, err := cfg.db.ListOAuthClients(r.Context(), claims.UserID)
+	if err != nil {
+		log.Printf("Failed to list oauth clients for user %s: %v", claims.UserID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	response := []oauthClientJson{}
+	for _, client := range clients {
+		response = append(response, newOAuthClientJson(client))
+	}
+	respondWithJson(w, http.StatusOK, response)
+}
+
+func (cfg *apiConfig) handlerDeleteOAuthClient(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Invalid client id provided",
+		})
+		return
+	}
+
+	// Refresh tokens and authorization codes issued to the client go with it
+	rows, err := cfg.db.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+		ID:     clientID,
+		UserID: claims.UserID,
+	})
+	if err != nil {
+		log.Printf("Failed to delete oauth client %s: %v", clientID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	if rows == 0 {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Client does not exist",
+		})
+		return
+	}
+
+	log.Printf("OAuth client %s deleted by user %s", clientID, claims.UserID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerSetOAuthClientIntrospection lets an admin mark a confidential client
+// as a resource server trusted to introspect tokens.
+func (cfg *apiConfig) handlerSetOAuthClientIntrospection(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	type requestParams struct {
+		CanIntrospect bool `json:"can_introspect"`
+	}
+
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Invalid client id provided",
+		})
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := requestParams{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "Couldn't decode parameters",
+		})
+		return
+	}
+
+	rows, err := cfg.db.SetOAuthClientCanIntrospect(r.Context(), database.SetOAuthClientCanIntrospectParams{
+		ID:            clientID,
+		CanIntrospect: params.CanIntrospect,
+	})
+	if err != nil {
+		log.Printf("Failed to update oauth client %s: %v", clientID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	if rows == 0 {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Client does not exist",
+		})
+		return
+	}
+
+	log.Printf("Introspection for oauth client %s set to %v by %s", clientID, params.CanIntrospect, claims.UserID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestValidateRedirectURI(t *testing.T) {
+	tests := []struct {
+		name    string
+		uri     string
+		wantErr bool
+	}{
+		{name: "https", uri: "https://app.example.com/callback", wantErr: false},
+		{name: "Loopback http", uri: "http://127.0.0.1:9000/callback", wantErr: false},
+		{name: "Localhost http", uri: "http://localhost/callback", wantErr: false},
+		{name: "Private scheme", uri: "com.example.app:/oauth", wantErr: false},
+		{name: "Remote http", uri: "http://app.example.com/callback", wantErr: true},
+		{name: "Relative", uri: "/callback", wantErr: true},
+		{name: "Fragment", uri: "https://app.example.com/callback#token", wantErr: true},
+		{name: "Javascript", uri: "javascript:alert(1)", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateRedirectURI(test.uri)
+			if (err != nil) != test.wantErr {
+				t.Errorf("validateRedirectURI(%q) error = %v, wantErr %v", test.uri, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthorizeRedirect(t *testing.T) {
+	req := authorizeRequest{
+		RedirectURI: "https://app.example.com/callback?tenant=1",
+		State:       "xyz",
+	}
+	w := httptest.NewRecorder()
+	req.redirectWith(w, httptest.NewRequest(http.MethodPost, "/oauth/authorize", nil), url.Values{"code": {"abc"}})
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("redirectWith() status = %d, want %d", w.Code, http.StatusFound)
+	}
+	location, _ := url.Parse(w.Header().Get("Location"))
+	query := location.Query()
+	if location.Host != "app.example.com" || query.Get("tenant") != "1" || query.Get("code") != "abc" || query.Get("state") != "xyz" {
+		t.Errorf("redirectWith() Location = %s", location)
+	}
+}
+
+func TestAuthorizationCodeRedirectURI(t *testing.T) {
+	clientColumns := []string{"id", "created_at", "name", "secret_hash", "redirect_uris", "user_id", "can_introspect"}
+	codeColumns := []string{
+		"code_hash", "created_at", "expires_at", "used_at", "client_id",
+		"user_id", "redirect_uri", "scopes", "code_challenge",
+	}
+	callback := "https://app.example.com/callback"
+
+	tests := []struct {
+		name          string
+		authorizeURI  string
+		tokenURI      string
+		wantMatchFail bool
+	}{
+		{
+			name:         "Sent to both endpoints",
+			authorizeURI: callback,
+			tokenURI:     callback,
+		},
+		{
+			name:          "Sent at authorize only",
+			authorizeURI:  callback,
+			wantMatchFail: true,
+		},
+		{
+			name:          "Different at the token endpoint",
+			authorizeURI:  callback,
+			tokenURI:      "https://app.example.com/other",
+			wantMatchFail: true,
+		},
+		{
+			name: "Left out of both",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, mock := newMockConfig(t)
+			clientID := uuid.New()
+
+			mock.ExpectQuery(queryName("GetOAuthClient")).
+				WillReturnRows(sqlmock.NewRows(clientColumns).AddRow(
+					clientID.String(), time.Now(), "app", nil, callback, uuid.NewString(), false,
+				))
+			mock.ExpectQuery(queryName("UseOAuthAuthorizationCode")).
+				WillReturnRows(sqlmock.NewRows(codeColumns).AddRow(
+					"hash", time.Now(), time.Now().Add(time.Minute), time.Now(), clientID.String(),
+					uuid.NewString(), test.authorizeURI, "chirps:read", "challenge",
+				))
+
+			form := url.Values{
+				"grant_type":    {"authorization_code"},
+				"client_id":     {clientID.String()},
+				"code":          {"some-code"},
+				"code_verifier": {"wrong-verifier"},
+			}
+			if test.tokenURI != "" {
+				form.Set("redirect_uri", test.tokenURI)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			cfg.handlerOAuthToken(rec, req)
+
+			// A code that gets past the redirect URI check fails on the verifier
+			var got oauthError
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if gotMatchFail := !strings.Contains(got.Description, "code_verifier"); gotMatchFail != test.wantMatchFail {
+				t.Errorf("error = %+v, want redirect URI mismatch: %v", got, test.wantMatchFail)
+			}
+		})
+	}
+}
+
+func TestConsentKeepsRedirectURIAsSent(t *testing.T) {
+	clientColumns := []string{"id", "created_at", "name", "secret_hash", "redirect_uris", "user_id", "can_introspect"}
+	callback := "https://app.example.com/callback"
+	hash, err := testPasswordHasher.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sent := range []string{callback, ""} {
+		name := "Sent"
+		if sent == "" {
+			name = "Left to the only registered URI"
+		}
+		t.Run(name, func(t *testing.T) {
+			cfg, mock := newMockConfig(t)
+			cfg.passwordHasher = testPasswordHasher
+			cfg.accountThrottle = newLoginThrottle(3, time.Minute, time.Hour)
+			cfg.ipThrottle = newLoginThrottle(100, time.Minute, time.Hour)
+			clientID := uuid.New()
+			user := database.User{ID: uuid.New(), Email: "walt@example.com", HashedPassword: hash}
+			challenge := auth.PKCEChallenge("a-verifier-long-enough-to-be-accepted-by-the-server")
+
+			mock.ExpectQuery(queryName("GetOAuthClient")).
+				WillReturnRows(sqlmock.NewRows(clientColumns).AddRow(
+					clientID.String(), time.Now(), "app", nil, callback, uuid.NewString(), false,
+				))
+			mock.ExpectQuery(queryName("GetUserByEmail")).WillReturnRows(mockUserRows(user))
+			mock.ExpectExec(queryName("CreateOAuthAuthorizationCode")).
+				WithArgs(sqlmock.AnyArg(), clientID.String(), user.ID.String(), sent, "chirps:read", challenge).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			form := url.Values{
+				"response_type":         {"code"},
+				"client_id":             {clientID.String()},
+				"scope":                 {"chirps:read"},
+				"code_challenge":        {challenge},
+				"code_challenge_method": {"S256"},
+				"decision":              {"allow"},
+				"email":                 {user.Email},
+				"password":              {"correct horse"},
+			}
+			if sent != "" {
+				form.Set("redirect_uri", sent)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/oauth/authorize", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			cfg.handlerOAuthConsent(rec, req)
+
+			if rec.Code != http.StatusFound {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusFound, rec.Body)
+			}
+			if location := rec.Header().Get("Location"); !strings.HasPrefix(location, callback+"?") {
+				t.Errorf("Location = %s, want the registered callback", location)
+			}
+		})
+	}
+}
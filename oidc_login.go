@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/JakeBurrell/chirpy/internal/oidc"
+)
+
+const (
+	oidcCookieName     = "chirpy_oidc"
+	oidcCookiePath     = "/api/login/oidc"
+	oidcLoginLifetime  = 10 * time.Minute
+	oidcDefaultScopes  = "email profile"
+	oidcCallbackSuffix = "/api/login/oidc/callback"
+)
+
+var errOIDCEmailUnverified = errors.New("an account with this email exists but its address hasn't been verified")
+
+// loadOIDCProvider configures login through an external OpenID provider from
+// OIDC_ISSUER, OIDC_CLIENT_ID, OIDC_CLIENT_SECRET, OIDC_REDIRECT_URL and
+// OIDC_SCOPES. It returns nil when OIDC_ISSUER isn't set.
+func loadOIDCProvider(baseURL string) (*oidc.Provider, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+	clientID := os.Getenv("OIDC_CLIENT_ID")
+	if clientID == "" {
+		return nil, errors.New("OIDC_CLIENT_ID must be set when OIDC_ISSUER is")
+	}
+	redirectURL := os.Getenv("OIDC_REDIRECT_URL")
+	if redirectURL == "" {
+		redirectURL = baseURL + oidcCallbackSuffix
+	}
+	scopes := os.Getenv("OIDC_SCOPES")
+	if scopes == "" {
+		scopes = oidcDefaultScopes
+	}
+	return oidc.NewProvider(oidc.Config{
+		Issuer:       issuer,
+		ClientID:     clientID,
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
+		Scopes:       strings.Fields(scopes),
+	}), nil
+}
+
+// handlerOIDCLogin sends the browser to the identity provider. The state,
+// nonce and PKCE verifier are kept in a short lived cookie until it returns,
+// along with whether ?use_cookies=true asked for a cookie session.
+func (cfg *apiConfig) handlerOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if cfg.oidcProvider == nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Single sign-on is not configured",
+		})
+		return
+	}
+
+	values := make([]string, 3)
+	for i := range values {
+		value, err := auth.MakeOpaqueToken()
+		if err != nil {
+			log.Printf("Failed to generate oidc login state: %v", err)
+			respondWithJson(w, http.StatusInternalServerError, errorResponse{
+				Error: "Something went wrong",
+			})
+			return
+		}
+		values[i] = value
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+	if r.URL.Query().Get("use_cookies") == "true" {
+		values = append(values, "cookies")
+	}
+
+	target, err := cfg.oidcProvider.AuthCodeURL(r.Context(), state, nonce, auth.PKCEChallenge(verifier))
+	if err != nil {
+		log.Printf("Failed to build oidc authorization url: %v", err)
+		respondWithJson(w, http.StatusBadGateway, errorResponse{
+			Error: "Identity provider is unavailable",
+		})
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookieName,
+		Value:    strings.Join(values, "."),
+		Path:     oidcCookiePath,
+		MaxAge:   int(oidcLoginLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(cfg.baseURL, "https://"),
+		// Lax so the cookie comes back on the provider's top level redirect
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// handlerOIDCCallback completes a login started by handlerOIDCLogin and
+// responds like /api/login.
+func (cfg *apiConfig) handlerOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if cfg.oidcProvider == nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Single sign-on is not configured",
+		})
+		return
+	}
+
+	// The login attempt can only be completed once
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookieName,
+		Path:     oidcCookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(cfg.baseURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		log.Printf("Identity provider returned error: %s %s", providerErr, query.Get("error_description"))
+		respondWithJson(w, http.StatusUnauthorized, errorResponse{
+			Error: "Login was not completed at the identity provider",
+		})
+		return
+	}
+
+	cookie, err := r.Cookie(oidcCookieName)
+	if err != nil {
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "Login attempt expired, please try again",
+		})
+		return
+	}
+	values := strings.Split(cookie.Value, ".")
+	state := query.Get("state")
+	if len(values) < 3 || state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(values[0])) != 1 {
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "Invalid login state",
+		})
+		return
+	}
+	nonce, verifier := values[1], values[2]
+	useCookies := len(values) > 3 && values[3] == "cookies"
+
+	idToken, err := cfg.oidcProvider.Exchange(r.Context(), query.Get("code"), verifier)
+	if err != nil {
+		log.Printf("Failed to redeem oidc authorization code: %v", err)
+		respondWithJson(w, http.StatusUnauthorized, errorResponse{
+			Error: "Couldn't complete login with the identity provider",
+		})
+		return
+	}
+	claims, err := cfg.oidcProvider.VerifyIDToken(r.Context(), idToken, nonce)
+	if err != nil {
+		log.Printf("Rejected oidc id token: %v", err)
+		respondWithJson(w, http.StatusUnauthorized, errorResponse{
+			Error: "Couldn't complete login with the identity provider",
+		})
+		return
+	}
+
+	user, err := cfg.userForIdentity(r.Context(), claims)
+	if errors.Is(err, errOIDCEmailUnverified) {
+		respondWithJson(w, http.StatusConflict, errorResponse{
+			Error: "An account with this email already exists; verify its address before using single sign-on",
+		})
+		return
+	}
+	if isUniqueViolation(err) {
+		respondWithJson(w, http.StatusConflict, errorResponse{
+			Error: "Email already in use",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to find user for oidc subject %q: %v", claims.Subject, err)
+		respondWithJson(w, http.StatusUnauthorized, errorResponse{
+			Error: "Couldn't complete login with the identity provider",
+		})
+		return
+	}
+
+	cfg.respondWithFirstFactor(w, r, user, useCookies)
+}
+
+// userForIdentity returns the user linked to a provider identity. The first
+// login links it to the account with the same verified email, creating the
+// account if there is none.
+func (cfg *apiConfig) userForIdentity(ctx context.Context, claims oidc.Claims) (database.User, error) {
+	issuer := cfg.oidcProvider.Issuer()
+	identity, err := cfg.db.GetUserIdentity(ctx, database.GetUserIdentityParams{
+		Issuer:  issuer,
+		Subject: claims.Subject,
+	})
+	if err == nil {
+		return cfg.db.GetUserByID(ctx, identity.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return database.User{}, errors.New("identity provider did not assert a verified email")
+	}
+
+	tx, err := cfg.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	user, err := qtx.GetUserByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		// Whoever registered the address without confirming it may not own it
+		if !user.EmailVerifiedAt.Valid {
+			return database.User{}, errOIDCEmailUnverified
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		// Accounts made here have no password until one is set through a reset
+		var created database.CreateUserRow
+		created, err = qtx.CreateUser(ctx, database.CreateUserParams{
+			Email:          claims.Email,
+			HashedPassword: "",
+		})
+		if err == nil {
+			err = qtx.VerifyUserEmail(ctx, database.VerifyUserEmailParams{
+				ID:    created.ID,
+				Email: created.Email,
+			})
+		}
+		if err == nil {
+			user, err = qtx.GetUserByID(ctx, created.ID)
+		}
+		if err != nil {
+			return database.User{}, err
+		}
+		log.Printf("User %s created from oidc subject %q", user.ID, claims.Subject)
+	default:
+		return database.User{}, err
+	}
+
+	err = qtx.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		Issuer:  issuer,
+		Subject: claims.Subject,
+		UserID:  user.ID,
+	})
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		return database.User{}, err
+	}
+	log.Printf("OIDC subject %q linked to user %s", claims.Subject, user.ID)
+	return user, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	want := pageCursor{
+		CreatedAt: time.Date(2025, 3, 14, 15, 9, 26, 535897000, time.UTC),
+		ID:        uuid.New(),
+	}
+	got, err := decodeCursor(encodeCursor(want))
+	if err != nil {
+		t.Fatalf("decodeCursor() error = %v", err)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || got.ID != want.ID {
+		t.Errorf("decodeCursor() = %v, want %v", got, want)
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"not base64!",
+		"bm8tc2VwYXJhdG9y",
+	}
+	for _, test := range tests {
+		if _, err := decodeCursor(test); err == nil {
+			t.Errorf("decodeCursor(%q) expected error", test)
+		}
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    int
+		wantErr bool
+	}{
+		{query: "", want: defaultPageLimit},
+		{query: "?limit=5", want: 5},
+		{query: "?limit=0", wantErr: true},
+		{query: "?limit=101", wantErr: true},
+		{query: "?limit=abc", wantErr: true},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/api/chirps"+test.query, nil)
+		got, err := parseLimit(r)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseLimit(%q) error = %v, wantErr %v", test.query, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseLimit(%q) = %d, want %d", test.query, got, test.want)
+		}
+	}
+}
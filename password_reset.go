@@ -0,0 +1,167 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/JakeBurrell/chirpy/internal/mail"
+)
+
+func (cfg *apiConfig) handlerRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	type requestParams struct {
+		Email string `json:"email"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := requestParams{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "Couldn't decode parameters",
+		})
+		return
+	}
+
+	// Respond identically whether or not the account exists
+	user, err := cfg.db.GetUserByEmail(r.Context(), params.Email)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to look up user for password reset: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	token, err := auth.MakeOpaqueToken()
+	if err != nil {
+		log.Printf("Failed to create password reset token: %v", err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	err = cfg.db.CreatePasswordResetToken(r.Context(), database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+	})
+	if err != nil {
+		log.Printf("Failed to store password reset token: %v", err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	cfg.sendMailAsync(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf(
+			"Someone asked to reset the password for your Chirpy account.\n\n"+
+				"Use this token within the next hour to choose a new password:\n\n%s\n\n"+
+				"If this wasn't you, you can ignore this email.\n",
+			token,
+		),
+	})
+	log.Printf("Password reset requested for user %s", user.ID)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (cfg *apiConfig) handlerConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	type requestParams struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := requestParams{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "Couldn't decode parameters",
+		})
+		return
+	}
+
+	tx, err := cfg.sqlDB.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Failed to begin transaction: %v", err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	userID, err := qtx.UsePasswordResetToken(r.Context(), auth.HashToken(params.Token))
+	if err != nil {
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "Invalid or expired token",
+		})
+		return
+	}
+
+	user, err := qtx.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("Failed to load user %s for password reset: %v", userID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	// Rejecting the password rolls back the transaction so the token can be
+	// used again with a better one
+	if !cfg.checkPasswordPolicy(w, r, params.Password, user.Email) {
+		return
+	}
+
+	hashedPassword, err := cfg.passwordHasher.Hash(params.Password)
+	if err != nil {
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Password could not be hashed",
+		})
+		return
+	}
+
+	_, err = qtx.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		ID:             userID,
+		HashedPassword: hashedPassword,
+	})
+	if err == nil {
+		err = qtx.InvalidatePasswordResetTokens(r.Context(), userID)
+	}
+	if err == nil {
+		err = qtx.RevokeAllUserTokens(r.Context(), userID)
+	}
+	if err == nil {
+		err = qtx.RevokeUserAPIKeys(r.Context(), userID)
+	}
+	var notBefore time.Time
+	if err == nil {
+		notBefore, err = storeUserTokenCutoff(r.Context(), qtx, userID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Failed to reset password for user %s: %v", userID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	cfg.revocations.setCutoff(userID, notBefore)
+
+	log.Printf("Password reset for user %s", userID)
+	w.WriteHeader(http.StatusNoContent)
+}
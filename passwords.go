@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// loadPasswordHasher configures how new password hashes are made.
+// PASSWORD_HASH_ALGORITHM selects argon2id (the default) or bcrypt; the
+// ARGON2_MEMORY_KIB, ARGON2_ITERATIONS, ARGON2_PARALLELISM and BCRYPT_COST
+// variables override their parameters. Existing hashes made with other
+// settings are upgraded the next time their owner logs in.
+func loadPasswordHasher() (auth.PasswordHasher, error) {
+	switch algorithm := os.Getenv("PASSWORD_HASH_ALGORITHM"); algorithm {
+	case "", "argon2id":
+		hasher := auth.DefaultArgon2idHasher
+		memory, err := uintEnv("ARGON2_MEMORY_KIB", uint64(hasher.Memory), 32)
+		if err != nil {
+			return nil, err
+		}
+		iterations, err := uintEnv("ARGON2_ITERATIONS", uint64(hasher.Iterations), 32)
+		if err != nil {
+			return nil, err
+		}
+		parallelism, err := uintEnv("ARGON2_PARALLELISM", uint64(hasher.Parallelism), 8)
+		if err != nil {
+			return nil, err
+		}
+		hasher.Memory = uint32(memory)
+		hasher.Iterations = uint32(iterations)
+		hasher.Parallelism = uint8(parallelism)
+		if hasher.Iterations == 0 || hasher.Parallelism == 0 {
+			return nil, fmt.Errorf("argon2 iterations and parallelism must be positive")
+		}
+		return hasher, nil
+	case "bcrypt":
+		cost, err := uintEnv("BCRYPT_COST", uint64(bcrypt.DefaultCost), 8)
+		if err != nil {
+			return nil, err
+		}
+		if int(cost) < bcrypt.MinCost || int(cost) > bcrypt.MaxCost {
+			return nil, fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return auth.BcryptHasher{Cost: int(cost)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported PASSWORD_HASH_ALGORITHM %q", algorithm)
+	}
+}
+
+func uintEnv(name string, fallback uint64, bitSize int) (uint64, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.ParseUint(value, 10, bitSize)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return parsed, nil
+}
+
+// loadPasswordPolicy configures the rules new passwords must satisfy.
+// PASSWORD_MIN_LENGTH and PASSWORD_MAX_LENGTH override the length limits and
+// PASSWORD_ALLOW_EMAIL=true permits passwords matching the email address.
+// Breached passwords are checked against a small bundled list unless
+// BREACHED_PASSWORDS_FILE names a file of SHA-1 digests or
+// BREACHED_PASSWORDS_DIR names a directory of Pwned Passwords range files.
+func loadPasswordPolicy() (auth.PasswordPolicy, error) {
+	policy := auth.DefaultPasswordPolicy
+	minLength, err := uintEnv("PASSWORD_MIN_LENGTH", uint64(policy.MinLength), 16)
+	if err != nil {
+		return auth.PasswordPolicy{}, err
+	}
+	maxLength, err := uintEnv("PASSWORD_MAX_LENGTH", uint64(policy.MaxLength), 16)
+	if err != nil {
+		return auth.PasswordPolicy{}, err
+	}
+	policy.MinLength = int(minLength)
+	policy.MaxLength = int(maxLength)
+	if policy.MaxLength != 0 && policy.MaxLength < policy.MinLength {
+		return auth.PasswordPolicy{}, fmt.Errorf("PASSWORD_MAX_LENGTH must not be less than PASSWORD_MIN_LENGTH")
+	}
+	policy.AllowEmail = os.Getenv("PASSWORD_ALLOW_EMAIL") == "true"
+
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return auth.PasswordPolicy{}, err
+		}
+		defer file.Close()
+		list, err := auth.LoadBreachedPasswordList(file)
+		if err != nil {
+			return auth.PasswordPolicy{}, fmt.Errorf("invalid BREACHED_PASSWORDS_FILE: %w", err)
+		}
+		policy.Breached = list
+	} else if dir := os.Getenv("BREACHED_PASSWORDS_DIR"); dir != "" {
+		policy.Breached = auth.BreachedPasswordDir{Dir: dir}
+	}
+	return policy, nil
+}
+
+type passwordPolicyResponse struct {
+	Error      string                 `json:"error"`
+	Violations []auth.PolicyViolation `json:"violations"`
+}
+
+// checkPasswordPolicy validates a new password for the account with the given
+// email, responding with every rule it fails. It reports whether the
+// password is acceptable.
+func (cfg *apiConfig) checkPasswordPolicy(w http.ResponseWriter, r *http.Request, password, email string) bool {
+	violations, err := cfg.passwordPolicy.Validate(r.Context(), password, email)
+	if err != nil {
+		// The remaining rules still apply when the breached list is unavailable
+		log.Printf("Password policy check incomplete: %v", err)
+	}
+	if len(violations) == 0 {
+		return true
+	}
+	respondWithJson(w, http.StatusBadRequest, passwordPolicyResponse{
+		Error:      "Password does not meet the password policy",
+		Violations: violations,
+	})
+	return false
+}
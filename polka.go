@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+type polkaWebhookRequest struct {
+	Event string `json:"event"`
+	Data  struct {
+		UserID uuid.UUID `json:"user_id"`
+	} `json:"data"`
+}
+
+func (cfg *apiConfig) handlerPolkaWebhook(w http.ResponseWriter, r *http.Request) {
+	apiKey, err := auth.GetAPIKey(r.Header)
+	if err != nil || cfg.polkaKey == "" ||
+		subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.polkaKey)) != 1 {
+		respondWithJson(w, http.StatusUnauthorized, errorResponse{
+			Error: "Invalid API key",
+		})
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := polkaWebhookRequest{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding webhook: %s", err)
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "Couldn't decode parameters",
+		})
+		return
+	}
+
+	// Events we don't care about are acknowledged so Polka stops retrying
+	if params.Event != "user.upgraded" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Upgrading is idempotent so replayed webhooks succeed as well
+	rows, err := cfg.db.UpgradeUserToChirpyRed(r.Context(), params.Data.UserID)
+	if err != nil {
+		log.Printf("Failed to upgrade user %s: %v", params.Data.UserID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	if rows == 0 {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "User does not exist",
+		})
+		return
+	}
+
+	log.Printf("User %s upgraded to Chirpy Red", params.Data.UserID)
+	w.WriteHeader(http.StatusNoContent)
+}
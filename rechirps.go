@@ -0,0 +1,118 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// handlerRechirp shares someone's chirp under the caller's name. Each user
+// can rechirp a chirp once; repeating the request returns the existing
+// rechirp.
+func (cfg *apiConfig) handlerRechirp(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Invalid chirp id provided",
+		})
+		return
+	}
+
+	if !cfg.checkCanPost(w, r, claims.UserID) {
+		return
+	}
+
+	original, err := cfg.db.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Chirp does not exist",
+		})
+		return
+	}
+	// Rechirping a rechirp shares the chirp it points to
+	originalID := uuid.NullUUID{UUID: original.ID, Valid: true}
+	if original.RechirpOfID.Valid {
+		originalID = original.RechirpOfID
+	}
+	viewer := uuid.NullUUID{UUID: claims.UserID, Valid: true}
+	existing := database.GetRechirpParams{
+		UserID:      claims.UserID,
+		RechirpOfID: originalID,
+	}
+
+	if rechirp, err := cfg.db.GetRechirp(r.Context(), existing); err == nil {
+		cfg.respondWithChirp(w, r, http.StatusOK, rechirp, viewer)
+		return
+	}
+
+	rechirp, err := cfg.db.CreateChirp(r.Context(), database.CreateChirpParams{
+		UserID:      claims.UserID,
+		RechirpOfID: originalID,
+	})
+	// Lost a race with the same request
+	if isUniqueViolation(err) {
+		rechirp, err = cfg.db.GetRechirp(r.Context(), existing)
+		if err == nil {
+			cfg.respondWithChirp(w, r, http.StatusOK, rechirp, viewer)
+			return
+		}
+	}
+	if isForeignKeyViolation(err) {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Chirp does not exist",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to rechirp %s for user %s: %v", originalID.UUID, claims.UserID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	log.Printf("Chirp %s was rechirped by %s", originalID.UUID, claims.UserID)
+	cfg.respondWithChirp(w, r, http.StatusCreated, rechirp, viewer)
+}
+
+// handlerUndoRechirp removes the caller's rechirp of a chirp. It succeeds
+// whether or not the chirp was rechirped.
+func (cfg *apiConfig) handlerUndoRechirp(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Invalid chirp id provided",
+		})
+		return
+	}
+
+	original, err := cfg.db.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Chirp does not exist",
+		})
+		return
+	}
+	// Rechirps always point at the chirp being shared, as in handlerRechirp
+	originalID := uuid.NullUUID{UUID: original.ID, Valid: true}
+	if original.RechirpOfID.Valid {
+		originalID = original.RechirpOfID
+	}
+
+	err = cfg.db.DeleteRechirp(r.Context(), database.DeleteRechirpParams{
+		UserID:      claims.UserID,
+		RechirpOfID: originalID,
+	})
+	if err != nil {
+		log.Printf("Failed to undo rechirp of %s for user %s: %v", originalID.UUID, claims.UserID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestChirpsEmbedOriginals(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	original := database.Chirp{ID: uuid.New(), Body: "original", UserID: uuid.New()}
+	deleted := database.Chirp{
+		ID:        uuid.New(),
+		UserID:    uuid.New(),
+		DeletedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	}
+	rechirp := database.Chirp{ID: uuid.New(), UserID: uuid.New(), RechirpOfID: uuid.NullUUID{UUID: original.ID, Valid: true}}
+	quote := database.Chirp{ID: uuid.New(), Body: "rip", UserID: uuid.New(), QuoteOfID: uuid.NullUUID{UUID: deleted.ID, Valid: true}}
+	plain := database.Chirp{ID: uuid.New(), Body: "hello", UserID: uuid.New()}
+
+	// Every embedded chirp is loaded at once, tombstones included, and counted
+	// along with the rest
+	mock.ExpectQuery(queryName("ListChirpsByIDs")).WillReturnRows(mockChirpRows(original, deleted))
+	expectChirpCounts(mock, chirpCounts{
+		rechirps: sqlmock.NewRows([]string{"chirp_id", "rechirp_count"}).AddRow(original.ID.String(), 1),
+	})
+
+	got, err := cfg.newChirpsJson(t.Context(), []database.Chirp{rechirp, quote, plain}, uuid.NullUUID{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 3 {
+		t.Fatalf("got %d chirps, want 3", len(got))
+	}
+	if got[0].RechirpOf == nil || got[0].RechirpOf.ID != original.ID || got[0].RechirpOf.Body != "original" {
+		t.Errorf("rechirp_of = %+v, want the original", got[0].RechirpOf)
+	} else if got[0].RechirpOf.RechirpCount != 1 {
+		t.Errorf("rechirp_count of the original = %d, want 1", got[0].RechirpOf.RechirpCount)
+	}
+	if got[1].QuotedChirp == nil || got[1].QuotedChirp.ID != deleted.ID || !got[1].QuotedChirp.Deleted {
+		t.Errorf("quoted_chirp = %+v, want the deleted chirp", got[1].QuotedChirp)
+	}
+	if got[2].RechirpOf != nil || got[2].QuotedChirp != nil {
+		t.Errorf("plain chirp embeds %+v and %+v, want nothing", got[2].RechirpOf, got[2].QuotedChirp)
+	}
+}
+
+func TestRechirpOfRechirpSharesOriginal(t *testing.T) {
+	original := database.Chirp{ID: uuid.New(), Body: "original", UserID: uuid.New()}
+	rechirp := database.Chirp{ID: uuid.New(), UserID: uuid.New(), RechirpOfID: uuid.NullUUID{UUID: original.ID, Valid: true}}
+
+	tests := []struct {
+		name       string
+		existing   bool
+		wantStatus int
+	}{
+		{
+			name:       "First rechirp",
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "Repeated rechirp",
+			existing:   true,
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, mock := newMockConfig(t)
+			userID := uuid.New()
+			mine := database.Chirp{ID: uuid.New(), UserID: userID, RechirpOfID: rechirp.RechirpOfID}
+
+			mock.ExpectQuery(queryName("GetChirp")).
+				WithArgs(rechirp.ID.String()).
+				WillReturnRows(mockChirpRows(rechirp))
+			getRechirp := mock.ExpectQuery(queryName("GetRechirp")).
+				WithArgs(userID.String(), original.ID.String())
+			if test.existing {
+				getRechirp.WillReturnRows(mockChirpRows(mine))
+			} else {
+				getRechirp.WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery(queryName("CreateChirp")).
+					WithArgs("", userID.String(), nil, original.ID.String(), nil).
+					WillReturnRows(mockChirpRows(mine))
+			}
+			mock.ExpectQuery(queryName("ListChirpsByIDs")).WillReturnRows(mockChirpRows(original))
+			expectChirpCounts(mock, chirpCounts{})
+
+			req := httptest.NewRequest(http.MethodPut, "/api/chirps/"+rechirp.ID.String()+"/rechirp", nil)
+			req.SetPathValue("chirpID", rechirp.ID.String())
+			rec := httptest.NewRecorder()
+			cfg.handlerRechirp(rec, req, auth.AccessClaims{UserID: userID})
+
+			if rec.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, test.wantStatus, rec.Body)
+			}
+			var got chirpJson
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.ID != mine.ID || got.RechirpOf == nil || got.RechirpOf.ID != original.ID {
+				t.Errorf("response = %+v, want a rechirp of the original", got)
+			}
+		})
+	}
+}
+
+func TestUndoRechirpResolvesOriginal(t *testing.T) {
+	original := database.Chirp{ID: uuid.New(), Body: "original", UserID: uuid.New()}
+	rechirp := database.Chirp{ID: uuid.New(), UserID: uuid.New(), RechirpOfID: uuid.NullUUID{UUID: original.ID, Valid: true}}
+
+	for _, target := range []database.Chirp{original, rechirp} {
+		name := "Original"
+		if target.RechirpOfID.Valid {
+			name = "Someone's rechirp of it"
+		}
+		t.Run(name, func(t *testing.T) {
+			cfg, mock := newMockConfig(t)
+			userID := uuid.New()
+
+			mock.ExpectQuery(queryName("GetChirp")).
+				WithArgs(target.ID.String()).
+				WillReturnRows(mockChirpRows(target))
+			mock.ExpectExec(queryName("DeleteRechirp")).
+				WithArgs(userID.String(), original.ID.String()).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/chirps/"+target.ID.String()+"/rechirp", nil)
+			req.SetPathValue("chirpID", target.ID.String())
+			rec := httptest.NewRecorder()
+			cfg.handlerUndoRechirp(rec, req, auth.AccessClaims{UserID: userID})
+
+			if rec.Code != http.StatusNoContent {
+				t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusNoContent, rec.Body)
+			}
+		})
+	}
+}
+
+func TestDeleteRechirpedChirp(t *testing.T) {
+	tests := []struct {
+		name        string
+		quoted      bool
+		wantQueries []string
+	}{
+		{
+			// Tombstones stay in the table, so their rechirps are removed
+			// explicitly
+			name:        "Quoted chirp becomes a tombstone",
+			quoted:      true,
+			wantQueries: []string{"DeleteChirpRevisions", "DeleteRechirps"},
+		},
+		{
+			// Rechirps alone don't keep a tombstone and go by the cascade
+			name:        "Chirp that is only rechirped is deleted",
+			wantQueries: []string{"DeleteChirp"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, mock := newMockConfig(t)
+			chirp := database.Chirp{ID: uuid.New(), Body: "original", UserID: uuid.New()}
+
+			mock.ExpectQuery(queryName("GetChirp")).WillReturnRows(mockChirpRows(chirp))
+			mock.ExpectBegin()
+			tombstoned := int64(0)
+			if test.quoted {
+				tombstoned = 1
+			}
+			mock.ExpectExec(queryName("TombstoneChirp") + `(?s).*quotes\.quote_of_id = chirps\.id`).
+				WithArgs(chirp.ID.String()).
+				WillReturnResult(sqlmock.NewResult(0, tombstoned))
+			for _, query := range test.wantQueries {
+				mock.ExpectExec(queryName(query)).
+					WithArgs(chirp.ID.String()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			mock.ExpectCommit()
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/chirps/"+chirp.ID.String(), nil)
+			req.SetPathValue("chirpID", chirp.ID.String())
+			rec := httptest.NewRecorder()
+			cfg.handlerDeleteChirps(rec, req, auth.AccessClaims{UserID: chirp.UserID})
+
+			if rec.Code != http.StatusNoContent {
+				t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusNoContent, rec.Body)
+			}
+		})
+	}
+}
+
+func TestEditQuoteKeepsBody(t *testing.T) {
+	for _, body := range []string{"", "   "} {
+		t.Run("Body "+strconv.Quote(body), func(t *testing.T) {
+			cfg, mock := newMockConfig(t)
+			quote := database.Chirp{
+				ID:        uuid.New(),
+				Body:      "rip",
+				UserID:    uuid.New(),
+				QuoteOfID: uuid.NullUUID{UUID: uuid.New(), Valid: true},
+			}
+
+			// Nothing is written, so no revision or update query is expected
+			mock.ExpectBegin()
+			mock.ExpectQuery(queryName("GetChirpForUpdate")).
+				WithArgs(quote.ID.String()).
+				WillReturnRows(mockChirpRows(quote))
+			mock.ExpectRollback()
+
+			req := httptest.NewRequest(http.MethodPut, "/api/chirps/"+quote.ID.String(), strings.NewReader(
+				`{"body":`+strconv.Quote(body)+`}`,
+			))
+			req.SetPathValue("chirpID", quote.ID.String())
+			rec := httptest.NewRecorder()
+			cfg.handlerUpdateChirp(rec, req, auth.AccessClaims{UserID: quote.UserID})
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+			}
+		})
+	}
+}
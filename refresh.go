@@ -1,21 +1,46 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"time"
 
 	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/google/uuid"
 )
 
 type TokenReponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+var errRefreshTokenReused = errors.New("refresh token reused")
+
+// refreshTokenFromRequest returns the refresh token sent as a bearer token or,
+// failing that, in the session cookie, and whether it came from the cookie.
+func refreshTokenFromRequest(r *http.Request) (string, bool, error) {
+	token, fromCookie, err := sessionCookie(r, refreshTokenCookie)
+	if fromCookie {
+		return token, true, err
+	}
+	token, err = auth.GetBearerToken(r.Header)
+	return token, false, err
 }
 
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 	// Validate token
-	token, err := auth.GetBearerToken(r.Header)
+	token, fromCookie, err := refreshTokenFromRequest(r)
+	if errors.Is(err, errCSRFTokenMismatch) {
+		respondWithJson(w, http.StatusForbidden, errorResponse{
+			Error: "Missing or invalid CSRF token",
+		})
+		return
+	}
 	if err != nil {
 		respondWithJson(w, http.StatusUnauthorized, errorResponse{
 			Error: fmt.Sprintf("Failed to validate authorization: %v", err),
@@ -23,7 +48,15 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user_id, err := cfg.db.GetUserFromRefreshToken(r.Context(), token)
+	newRefreshToken, current, err := cfg.rotateRefreshToken(r, token, uuid.NullUUID{})
+	if err != nil {
+		respondWithJson(w, http.StatusUnauthorized, errorResponse{
+			Error: "Invalid token",
+		})
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), current.UserID)
 	if err != nil {
 		respondWithJson(w, http.StatusUnauthorized, errorResponse{
 			Error: "Invalid token",
@@ -31,15 +64,132 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accessToken, err := auth.MakeJWT(user_id, cfg.secret, time.Hour)
+	// Role changes take effect from the next refresh
+	accessToken, err := cfg.makeAccessToken(user)
 	if err != nil {
 		log.Printf("failed to create jwt token: %v", err)
 		respondWithJson(w, http.StatusInternalServerError, errorResponse{
 			Error: "Failed to create token",
 		})
+		return
+	}
+
+	if fromCookie {
+		// The csrf token stays the same for the life of the session
+		csrfToken, _ := r.Cookie(csrfCookie)
+		setSessionCookies(w, accessToken, newRefreshToken, csrfToken.Value)
+		w.WriteHeader(http.StatusNoContent)
+		return
 	}
 
 	respondWithJson(w, http.StatusOK, TokenReponse{
-		Token: accessToken,
+		Token:        accessToken,
+		RefreshToken: newRefreshToken,
+	})
+}
+
+// refreshTokenFamily identifies the session a refresh token belongs to.
+type refreshTokenFamily struct {
+	UserID   uuid.UUID
+	FamilyID uuid.UUID
+	// ClientID and Scopes are only set for tokens issued to OAuth clients,
+	// whose access tokens are limited to the scopes the user granted.
+	ClientID uuid.NullUUID
+	Scopes   sql.NullString
+}
+
+// createRefreshToken issues a new refresh token belonging to the given token
+// family, recording the client that made the request.
+func (cfg *apiConfig) createRefreshToken(r *http.Request, q *database.Queries, family refreshTokenFamily) (string, error) {
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	err = q.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		TokenHash: auth.HashToken(refreshToken),
+		UserID:    family.UserID,
+		FamilyID:  family.FamilyID,
+		UserAgent: r.UserAgent(),
+		IpAddress: cfg.clientIP(r),
+		ClientID:  family.ClientID,
+		Scopes:    family.Scopes,
 	})
+	if err != nil {
+		return "", err
+	}
+	return refreshToken, nil
+}
+
+// rotateRefreshToken revokes the presented refresh token and issues its
+// replacement in the same family, returning the new token and the one it
+// replaced. Presenting a token that has already been rotated revokes the
+// entire family. Tokens are only accepted from the OAuth client they were
+// issued to, or from first-party clients when clientID is null.
+func (cfg *apiConfig) rotateRefreshToken(r *http.Request, token string, clientID uuid.NullUUID) (string, database.RefreshToken, error) {
+	ctx := r.Context()
+	current, err := cfg.db.GetRefreshToken(ctx, auth.HashToken(token))
+	if err != nil {
+		return "", database.RefreshToken{}, err
+	}
+	if current.ClientID != clientID {
+		return "", database.RefreshToken{}, errors.New("refresh token issued to another client")
+	}
+
+	if current.ReplacedBy.Valid {
+		cfg.revokeReusedFamily(ctx, current)
+		return "", database.RefreshToken{}, errRefreshTokenReused
+	}
+	if current.RevokedAt.Valid {
+		return "", database.RefreshToken{}, errors.New("refresh token revoked")
+	}
+	if !current.ExpiresAt.After(time.Now().UTC()) {
+		return "", database.RefreshToken{}, errors.New("refresh token expired")
+	}
+
+	tx, err := cfg.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", database.RefreshToken{}, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	newToken, err := cfg.createRefreshToken(r, qtx, refreshTokenFamily{
+		UserID:   current.UserID,
+		FamilyID: current.FamilyID,
+		ClientID: current.ClientID,
+		Scopes:   current.Scopes,
+	})
+	if err != nil {
+		return "", database.RefreshToken{}, err
+	}
+
+	rows, err := qtx.RotateRefreshToken(ctx, database.RotateRefreshTokenParams{
+		TokenHash:  current.TokenHash,
+		ReplacedBy: sql.NullString{String: auth.HashToken(newToken), Valid: true},
+	})
+	if err != nil {
+		return "", database.RefreshToken{}, err
+	}
+	if rows == 0 {
+		// Another request rotated this token first
+		tx.Rollback()
+		cfg.revokeReusedFamily(ctx, current)
+		return "", database.RefreshToken{}, errRefreshTokenReused
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", database.RefreshToken{}, err
+	}
+	return newToken, current, nil
+}
+
+func (cfg *apiConfig) revokeReusedFamily(ctx context.Context, token database.RefreshToken) {
+	log.Printf("Refresh token reuse detected for user %s, revoking token family %s", token.UserID, token.FamilyID)
+	_, err := cfg.db.RevokeTokenFamily(ctx, database.RevokeTokenFamilyParams{
+		FamilyID: token.FamilyID,
+		UserID:   token.UserID,
+	})
+	if err != nil {
+		log.Printf("Failed to revoke token family %s: %v", token.FamilyID, err)
+	}
 }
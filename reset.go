@@ -3,15 +3,19 @@ package main
 import (
 	"log"
 	"net/http"
+
+	"github.com/JakeBurrell/chirpy/internal/auth"
 )
 
-func (cfg *apiConfig) handlerReset(w http.ResponseWriter, r *http.Request) {
+// handlerReset wipes the database. Besides needing an admin it only works
+// in development.
+func (cfg *apiConfig) handlerReset(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
 
 	if cfg.platform != "dev" {
 		respondWithJson(w, http.StatusForbidden, errorResponse{
 			Error: "Something went wrong",
 		})
-		log.Printf("Attempt to delete users outside of development")
+		log.Printf("Attempt by %s to delete users outside of development", claims.UserID)
 		return
 	}
 
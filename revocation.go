@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const revocationCacheTTL = 30 * time.Second
+
+var errAccessTokenRevoked = errors.New("token has been revoked")
+
+type cachedCutoff struct {
+	notBefore time.Time
+	fetchedAt time.Time
+}
+
+type cachedDenial struct {
+	revoked   bool
+	fetchedAt time.Time
+}
+
+// revocationCache keeps recent answers from the user_token_cutoffs and
+// revoked_access_tokens tables so authenticating a request rarely needs a
+// database round trip. Revocations made by this instance take effect
+// immediately; ones made elsewhere within revocationCacheTTL.
+type revocationCache struct {
+	mu      sync.Mutex
+	cutoffs map[uuid.UUID]cachedCutoff
+	denied  map[string]cachedDenial
+}
+
+func newRevocationCache() *revocationCache {
+	return &revocationCache{
+		cutoffs: map[uuid.UUID]cachedCutoff{},
+		denied:  map[string]cachedDenial{},
+	}
+}
+
+func (c *revocationCache) cutoff(ctx context.Context, db *database.Queries, userID uuid.UUID) (time.Time, error) {
+	c.mu.Lock()
+	cached, ok := c.cutoffs[userID]
+	c.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < revocationCacheTTL {
+		return cached.notBefore, nil
+	}
+
+	notBefore, err := db.GetUserTokenCutoff(ctx, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, err
+	}
+	c.setCutoff(userID, notBefore)
+	return notBefore, nil
+}
+
+func (c *revocationCache) setCutoff(userID uuid.UUID, notBefore time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cutoffs[userID] = cachedCutoff{notBefore: notBefore, fetchedAt: time.Now()}
+}
+
+func (c *revocationCache) isDenied(ctx context.Context, db *database.Queries, tokenID string) (bool, error) {
+	c.mu.Lock()
+	cached, ok := c.denied[tokenID]
+	c.mu.Unlock()
+	if ok && (cached.revoked || time.Since(cached.fetchedAt) < revocationCacheTTL) {
+		return cached.revoked, nil
+	}
+
+	revoked, err := db.IsAccessTokenRevoked(ctx, tokenID)
+	if err != nil {
+		return false, err
+	}
+	c.setDenied(tokenID, revoked)
+	return revoked, nil
+}
+
+func (c *revocationCache) setDenied(tokenID string, revoked bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.denied[tokenID] = cachedDenial{revoked: revoked, fetchedAt: time.Now()}
+}
+
+// sweep drops entries that no longer save a lookup.
+func (c *revocationCache) sweep() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for userID, cached := range c.cutoffs {
+		if time.Since(cached.fetchedAt) >= revocationCacheTTL {
+			delete(c.cutoffs, userID)
+		}
+	}
+	for tokenID, cached := range c.denied {
+		// Revoked entries are kept for the lifetime of an access token
+		if time.Since(cached.fetchedAt) >= revocationCacheTTL && (!cached.revoked || time.Since(cached.fetchedAt) >= time.Hour) {
+			delete(c.denied, tokenID)
+		}
+	}
+}
+
+// authenticate validates the access token on the request, taken from the
+// Authorization header or the session cookie. Personal API keys sent as
+// "Authorization: ApiKey <key>" are accepted in place of an access token.
+func (cfg *apiConfig) authenticate(r *http.Request) (auth.AccessClaims, error) {
+	if token, ok, err := sessionCookie(r, accessTokenCookie); ok {
+		if err != nil {
+			return auth.AccessClaims{}, err
+		}
+		return cfg.validateAccessToken(r.Context(), token)
+	}
+	if key, err := auth.GetAPIKey(r.Header); err == nil {
+		return cfg.authenticateAPIKey(r.Context(), key)
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return auth.AccessClaims{}, err
+	}
+	return cfg.validateAccessToken(r.Context(), token)
+}
+
+// validateAccessToken verifies an access token and checks that it hasn't
+// been revoked since it was issued.
+func (cfg *apiConfig) validateAccessToken(ctx context.Context, token string) (auth.AccessClaims, error) {
+	claims, err := auth.ParseAccessToken(token, cfg.jwtKeys)
+	if err != nil {
+		return auth.AccessClaims{}, err
+	}
+
+	notBefore, err := cfg.revocations.cutoff(ctx, cfg.db, claims.UserID)
+	if err != nil {
+		log.Printf("Failed to check token cutoff for user %s: %v", claims.UserID, err)
+		return auth.AccessClaims{}, errAccessTokenRevoked
+	}
+	// iat only has second precision
+	if claims.IssuedAt.Before(notBefore.Truncate(time.Second)) {
+		return auth.AccessClaims{}, errAccessTokenRevoked
+	}
+
+	if claims.TokenID != "" {
+		denied, err := cfg.revocations.isDenied(ctx, cfg.db, claims.TokenID)
+		if err != nil {
+			log.Printf("Failed to check token denylist: %v", err)
+			return auth.AccessClaims{}, errAccessTokenRevoked
+		}
+		if denied {
+			return auth.AccessClaims{}, errAccessTokenRevoked
+		}
+	}
+
+	return claims, nil
+}
+
+// revokeUserAccessTokens invalidates every access token issued to the user so
+// far, e.g. after a password change. Inside a transaction use
+// storeUserTokenCutoff instead, so the cache can't run ahead of a rollback.
+func (cfg *apiConfig) revokeUserAccessTokens(ctx context.Context, q *database.Queries, userID uuid.UUID) error {
+	notBefore, err := storeUserTokenCutoff(ctx, q, userID)
+	if err != nil {
+		return err
+	}
+	cfg.revocations.setCutoff(userID, notBefore)
+	return nil
+}
+
+// storeUserTokenCutoff records the cutoff without touching the cache, for
+// use inside a transaction. The caller passes the returned time to
+// cfg.revocations.setCutoff once the transaction has committed.
+func storeUserTokenCutoff(ctx context.Context, q *database.Queries, userID uuid.UUID) (time.Time, error) {
+	notBefore := time.Now().UTC()
+	err := q.SetUserTokenCutoff(ctx, database.SetUserTokenCutoffParams{
+		UserID:    userID,
+		NotBefore: notBefore,
+	})
+	return notBefore, err
+}
+
+func (cfg *apiConfig) handlerLogout(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	if claims.TokenID == "" {
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "Token can't be revoked individually",
+		})
+		return
+	}
+
+	err := cfg.db.RevokeAccessToken(r.Context(), database.RevokeAccessTokenParams{
+		Jti:       claims.TokenID,
+		ExpiresAt: claims.ExpiresAt,
+		UserID:    claims.UserID,
+	})
+	if err != nil {
+		log.Printf("Failed to revoke access token: %v", err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	cfg.revocations.setDenied(claims.TokenID, true)
+	if r.Header.Get("Authorization") == "" {
+		clearSessionCookies(w)
+	}
+
+	if err := cfg.db.DeleteExpiredRevokedAccessTokens(r.Context()); err != nil {
+		log.Printf("Failed to prune revoked access tokens: %v", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
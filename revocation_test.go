@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRevocationCacheServesLocalRevocations(t *testing.T) {
+	cache := newRevocationCache()
+	userID := uuid.New()
+	notBefore := time.Now().UTC()
+
+	cache.setCutoff(userID, notBefore)
+	cache.setDenied("revoked-jti", true)
+
+	// A nil database proves the answers come from the cache
+	got, err := cache.cutoff(context.Background(), nil, userID)
+	if err != nil || !got.Equal(notBefore) {
+		t.Errorf("cutoff() = %v, %v, want %v", got, err, notBefore)
+	}
+	denied, err := cache.isDenied(context.Background(), nil, "revoked-jti")
+	if err != nil || !denied {
+		t.Errorf("isDenied() = %v, %v, want true", denied, err)
+	}
+}
+
+func TestRevocationCacheSweep(t *testing.T) {
+	cache := newRevocationCache()
+	staleUser := uuid.New()
+	freshUser := uuid.New()
+
+	cache.cutoffs[staleUser] = cachedCutoff{fetchedAt: time.Now().Add(-2 * revocationCacheTTL)}
+	cache.cutoffs[freshUser] = cachedCutoff{fetchedAt: time.Now()}
+	cache.denied["stale-allowed"] = cachedDenial{revoked: false, fetchedAt: time.Now().Add(-2 * revocationCacheTTL)}
+	cache.denied["stale-revoked"] = cachedDenial{revoked: true, fetchedAt: time.Now().Add(-2 * revocationCacheTTL)}
+
+	cache.sweep()
+
+	if _, ok := cache.cutoffs[staleUser]; ok {
+		t.Errorf("sweep() kept a stale cutoff")
+	}
+	if _, ok := cache.cutoffs[freshUser]; !ok {
+		t.Errorf("sweep() dropped a fresh cutoff")
+	}
+	if _, ok := cache.denied["stale-allowed"]; ok {
+		t.Errorf("sweep() kept a stale negative lookup")
+	}
+	if _, ok := cache.denied["stale-revoked"]; !ok {
+		t.Errorf("sweep() dropped a revoked token before it could have expired")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -8,7 +9,13 @@ import (
 )
 
 func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
+	token, fromCookie, err := refreshTokenFromRequest(r)
+	if errors.Is(err, errCSRFTokenMismatch) {
+		respondWithJson(w, http.StatusForbidden, errorResponse{
+			Error: "Missing or invalid CSRF token",
+		})
+		return
+	}
 	if err != nil {
 		respondWithJson(w, http.StatusBadRequest, errorResponse{
 			Error: fmt.Sprintf("No token provided: %v", err),
@@ -16,12 +23,15 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = cfg.db.RevokeToken(r.Context(), token)
+	err = cfg.db.RevokeToken(r.Context(), auth.HashToken(token))
 	if err != nil {
 		respondWithJson(w, http.StatusBadRequest, errorResponse{
 			Error: "Invalid token",
 		})
 		return
 	}
+	if fromCookie {
+		clearSessionCookies(w)
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
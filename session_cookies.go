@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Browser clients can opt in to keeping their tokens in HttpOnly cookies
+// instead of handling them in JavaScript. Requests authenticated by cookie
+// that change state must echo the csrf cookie in the X-CSRF-Token header,
+// which a cross-site page can't read.
+const (
+	accessTokenCookie  = "chirpy_access"
+	refreshTokenCookie = "chirpy_refresh"
+	csrfCookie         = "chirpy_csrf"
+	csrfHeader         = "X-CSRF-Token"
+
+	accessTokenLifetime  = time.Hour
+	refreshTokenLifetime = 7 * 24 * time.Hour
+)
+
+var errCSRFTokenMismatch = errors.New("missing or invalid csrf token")
+
+func newSessionCookie(name, value, path string, maxAge time.Duration, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: httpOnly,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+// setSessionCookies stores a session's tokens in cookies. The refresh token
+// is only sent to the endpoints under /api that use it.
+func setSessionCookies(w http.ResponseWriter, accessToken, refreshToken, csrfToken string) {
+	http.SetCookie(w, newSessionCookie(accessTokenCookie, accessToken, "/", accessTokenLifetime, true))
+	http.SetCookie(w, newSessionCookie(refreshTokenCookie, refreshToken, "/api", refreshTokenLifetime, true))
+	// Readable by the page so it can be sent back as a header
+	http.SetCookie(w, newSessionCookie(csrfCookie, csrfToken, "/", refreshTokenLifetime, false))
+}
+
+func clearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, newSessionCookie(accessTokenCookie, "", "/", -time.Second, true))
+	http.SetCookie(w, newSessionCookie(refreshTokenCookie, "", "/api", -time.Second, true))
+	http.SetCookie(w, newSessionCookie(csrfCookie, "", "/", -time.Second, false))
+}
+
+// checkCSRF verifies the double-submitted csrf token on requests that can
+// change state.
+func checkCSRF(r *http.Request) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return errCSRFTokenMismatch
+	}
+	header := r.Header.Get(csrfHeader)
+	if subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) != 1 {
+		return errCSRFTokenMismatch
+	}
+	return nil
+}
+
+// hasCredentials reports whether the request carries an Authorization header
+// or a session cookie, valid or not.
+func hasCredentials(r *http.Request) bool {
+	if r.Header.Get("Authorization") != "" {
+		return true
+	}
+	cookie, err := r.Cookie(accessTokenCookie)
+	return err == nil && cookie.Value != ""
+}
+
+// sessionCookie returns the value of a session cookie on a request that
+// carries no Authorization header, after checking its csrf token.
+func sessionCookie(r *http.Request, name string) (string, bool, error) {
+	if r.Header.Get("Authorization") != "" {
+		return "", false, nil
+	}
+	cookie, err := r.Cookie(name)
+	if err != nil || cookie.Value == "" {
+		return "", false, nil
+	}
+	if err := checkCSRF(r); err != nil {
+		return "", true, err
+	}
+	return cookie.Value, true, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSessionCookie(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		authorization  string
+		cookies        map[string]string
+		csrfHeader     string
+		wantToken      string
+		wantFromCookie bool
+		wantErr        bool
+	}{
+		{
+			name:   "No cookie",
+			method: http.MethodPost,
+		},
+		{
+			name:          "Authorization header takes precedence",
+			method:        http.MethodPost,
+			authorization: "Bearer abc",
+			cookies:       map[string]string{accessTokenCookie: "from-cookie"},
+		},
+		{
+			name:           "Safe method needs no csrf token",
+			method:         http.MethodGet,
+			cookies:        map[string]string{accessTokenCookie: "from-cookie"},
+			wantToken:      "from-cookie",
+			wantFromCookie: true,
+		},
+		{
+			name:           "Matching csrf token",
+			method:         http.MethodPost,
+			cookies:        map[string]string{accessTokenCookie: "from-cookie", csrfCookie: "csrf-1"},
+			csrfHeader:     "csrf-1",
+			wantToken:      "from-cookie",
+			wantFromCookie: true,
+		},
+		{
+			name:           "Missing csrf header",
+			method:         http.MethodDelete,
+			cookies:        map[string]string{accessTokenCookie: "from-cookie", csrfCookie: "csrf-1"},
+			wantFromCookie: true,
+			wantErr:        true,
+		},
+		{
+			name:           "Wrong csrf header",
+			method:         http.MethodPut,
+			cookies:        map[string]string{accessTokenCookie: "from-cookie", csrfCookie: "csrf-1"},
+			csrfHeader:     "csrf-2",
+			wantFromCookie: true,
+			wantErr:        true,
+		},
+		{
+			name:           "Missing csrf cookie",
+			method:         http.MethodPost,
+			cookies:        map[string]string{accessTokenCookie: "from-cookie"},
+			wantFromCookie: true,
+			wantErr:        true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, "/api/chirps", nil)
+			if test.authorization != "" {
+				r.Header.Set("Authorization", test.authorization)
+			}
+			for name, value := range test.cookies {
+				r.AddCookie(&http.Cookie{Name: name, Value: value})
+			}
+			if test.csrfHeader != "" {
+				r.Header.Set(csrfHeader, test.csrfHeader)
+			}
+
+			token, fromCookie, err := sessionCookie(r, accessTokenCookie)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("sessionCookie() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if fromCookie != test.wantFromCookie {
+				t.Errorf("sessionCookie() fromCookie = %v, want %v", fromCookie, test.wantFromCookie)
+			}
+			if !test.wantErr && token != test.wantToken {
+				t.Errorf("sessionCookie() token = %q, want %q", token, test.wantToken)
+			}
+		})
+	}
+}
+
+func TestSetSessionCookies(t *testing.T) {
+	w := httptest.NewRecorder()
+	setSessionCookies(w, "access", "refresh", "csrf")
+
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range w.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	for _, name := range []string{accessTokenCookie, refreshTokenCookie, csrfCookie} {
+		cookie, ok := cookies[name]
+		if !ok {
+			t.Fatalf("cookie %s not set", name)
+		}
+		if !cookie.Secure || cookie.SameSite != http.SameSiteStrictMode {
+			t.Errorf("cookie %s must be Secure and SameSite=Strict", name)
+		}
+		// The page has to be able to read the csrf token and nothing else
+		if cookie.HttpOnly != (name != csrfCookie) {
+			t.Errorf("cookie %s HttpOnly = %v", name, cookie.HttpOnly)
+		}
+	}
+	if cookies[refreshTokenCookie].Path != "/api" {
+		t.Errorf("refresh cookie path = %q, want /api", cookies[refreshTokenCookie].Path)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// sessionJson describes a login session. A session is a refresh token family,
+// so its id stays the same while the refresh token is rotated.
+type sessionJson struct {
+	ID         uuid.UUID `json:"id"`
+	StartedAt  time.Time `json:"started_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+}
+
+// clientIP returns the address of the client making the request. The
+// X-Forwarded-For header is only honoured when running behind a trusted proxy,
+// and only its last entry, which that proxy appended. Anything before it came
+// from the client and can be forged.
+func (cfg *apiConfig) clientIP(r *http.Request) string {
+	if cfg.trustProxyHeaders {
+		if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			forwarded := values[len(values)-1]
+			if i := strings.LastIndex(forwarded, ","); i >= 0 {
+				forwarded = forwarded[i+1:]
+			}
+			if last := strings.TrimSpace(forwarded); last != "" {
+				return last
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (cfg *apiConfig) handlerListSessions(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	userID := claims.UserID
+
+	sessions, err := cfg.db.ListActiveSessions(r.Context(), userID)
+	if err != nil {
+		log.Printf("Failed to list sessions for user %s: %v", userID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	jsonSessions := []sessionJson{}
+	for _, session := range sessions {
+		jsonSessions = append(jsonSessions, sessionJson{
+			ID:         session.FamilyID,
+			StartedAt:  session.StartedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IpAddress,
+		})
+	}
+	respondWithJson(w, http.StatusOK, jsonSessions)
+}
+
+func (cfg *apiConfig) handlerRevokeSession(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Invalid session id provided",
+		})
+		return
+	}
+
+	userID := claims.UserID
+
+	// Scoped to the caller so other users' sessions look like missing ones
+	rows, err := cfg.db.RevokeTokenFamily(r.Context(), database.RevokeTokenFamilyParams{
+		FamilyID: sessionID,
+		UserID:   userID,
+	})
+	if err != nil {
+		log.Printf("Failed to revoke session %s: %v", sessionID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	if rows == 0 {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Session does not exist",
+		})
+		return
+	}
+
+	log.Printf("Session %s revoked by user %s", sessionID, userID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerRevokeUserSessions lets an admin sign a user out everywhere and
+// revoke their API keys, e.g. when the account is suspected to be
+// compromised. It doesn't stop the user logging in again.
+func (cfg *apiConfig) handlerRevokeUserSessions(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "Invalid user id provided",
+		})
+		return
+	}
+
+	if _, err := cfg.db.GetUserByID(r.Context(), userID); err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "User does not exist",
+		})
+		return
+	}
+
+	tx, err := cfg.sqlDB.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Failed to begin transaction: %v", err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	var notBefore time.Time
+	err = qtx.RevokeAllUserTokens(r.Context(), userID)
+	if err == nil {
+		err = qtx.RevokeUserAPIKeys(r.Context(), userID)
+	}
+	if err == nil {
+		notBefore, err = storeUserTokenCutoff(r.Context(), qtx, userID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Failed to revoke sessions for user %s: %v", userID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	cfg.revocations.setCutoff(userID, notBefore)
+
+	log.Printf("All sessions of user %s revoked by %s", userID, claims.UserID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerLogoutAll ends every session of the caller and revokes their API
+// keys.
+func (cfg *apiConfig) handlerLogoutAll(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	userID := claims.UserID
+
+	err := cfg.db.RevokeAllUserTokens(r.Context(), userID)
+	if err == nil {
+		err = cfg.db.RevokeUserAPIKeys(r.Context(), userID)
+	}
+	if err == nil {
+		err = cfg.revokeUserAccessTokens(r.Context(), cfg.db, userID)
+	}
+	if err != nil {
+		log.Printf("Failed to revoke sessions for user %s: %v", userID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	log.Printf("All sessions revoked for user %s", userID)
+	w.WriteHeader(http.StatusNoContent)
+}
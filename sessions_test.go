@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestRevokeUserSessions(t *testing.T) {
+	tests := []struct {
+		name       string
+		commitErr  error
+		wantStatus int
+		wantCached bool
+	}{
+		{
+			name:       "Cutoff is cached after commit",
+			wantStatus: http.StatusNoContent,
+			wantCached: true,
+		},
+		{
+			name:       "Failed commit leaves the cache alone",
+			commitErr:  errors.New("connection lost"),
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, mock := newMockConfig(t)
+			user := database.User{ID: uuid.New(), Email: "walt@example.com"}
+
+			mock.ExpectQuery(queryName("GetUserByID")).WillReturnRows(mockUserRows(user))
+			mock.ExpectBegin()
+			mock.ExpectExec(queryName("RevokeAllUserTokens")).WillReturnResult(sqlmock.NewResult(0, 2))
+			mock.ExpectExec(queryName("RevokeUserAPIKeys")).
+				WithArgs(user.ID.String()).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(queryName("SetUserTokenCutoff")).WillReturnResult(sqlmock.NewResult(0, 1))
+			if test.commitErr != nil {
+				mock.ExpectCommit().WillReturnError(test.commitErr)
+			} else {
+				mock.ExpectCommit()
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/admin/users/"+user.ID.String()+"/revoke-sessions", nil)
+			req.SetPathValue("userID", user.ID.String())
+			rec := httptest.NewRecorder()
+			before := time.Now().UTC()
+			cfg.handlerRevokeUserSessions(rec, req, auth.AccessClaims{UserID: uuid.New()})
+
+			if rec.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, test.wantStatus, rec.Body)
+			}
+			cached, ok := cfg.revocations.cutoffs[user.ID]
+			if ok != test.wantCached {
+				t.Fatalf("cutoff cached = %v, want %v", ok, test.wantCached)
+			}
+			if ok && cached.notBefore.Before(before) {
+				t.Errorf("cached cutoff %v is older than the request", cached.notBefore)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		trusted   bool
+		forwarded []string
+		want      string
+	}{
+		{
+			name:      "Proxy headers ignored by default",
+			forwarded: []string{"198.51.100.1"},
+			want:      "192.0.2.1",
+		},
+		{
+			name:      "Entry appended by the proxy",
+			trusted:   true,
+			forwarded: []string{"198.51.100.1"},
+			want:      "198.51.100.1",
+		},
+		{
+			name:      "Entries sent by the client are ignored",
+			trusted:   true,
+			forwarded: []string{"203.0.113.9, 198.51.100.1"},
+			want:      "198.51.100.1",
+		},
+		{
+			name:      "Last of several headers",
+			trusted:   true,
+			forwarded: []string{"203.0.113.9", "198.51.100.1"},
+			want:      "198.51.100.1",
+		},
+		{
+			name:    "No header",
+			trusted: true,
+			want:    "192.0.2.1",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &apiConfig{trustProxyHeaders: test.trusted}
+			req := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+			req.RemoteAddr = "192.0.2.1:4321"
+			for _, value := range test.forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			if got := cfg.clientIP(req); got != test.want {
+				t.Errorf("clientIP() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+-- name: CreateChirpRevision :exec
+INSERT INTO chirp_revisions (id, created_at, replaced_at, body, chirp_id)
+VALUES (
+	gen_random_uuid(), $1, NOW(), $2, $3
+);
+
+-- name: ListChirpRevisions :many
+SELECT *
+FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY replaced_at DESC;
+
+-- name: DeleteChirpRevisions :exec
+DELETE FROM chirp_revisions
+WHERE chirp_id = $1;
@@ -1,21 +1,128 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, reply_to_id, rechirp_of_id, quote_of_id)
 VALUES (
-	gen_random_uuid(), NOW(), NOW(), $1, $2
+	gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4, $5
 )
-RETURNING id, created_at,  updated_at, body, user_id;
+RETURNING *;
 
--- name: GetAllChirps :many
-SELECT * 
+-- name: ListChirpsAsc :many
+SELECT *
+FROM chirps
+WHERE (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+AND deleted_at IS NULL
+AND (
+	sqlc.narg('cursor_created_at')::timestamp IS NULL
+	OR (created_at, id) > (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.narg('limit');
+
+-- name: ListChirpsDesc :many
+SELECT *
 FROM chirps
-ORDER BY created_at ASC;
+WHERE (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+AND deleted_at IS NULL
+AND (
+	sqlc.narg('cursor_created_at')::timestamp IS NULL
+	OR (created_at, id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.narg('limit');
 
 -- name: GetChirp :one
 SELECT *
 FROM chirps
-WHERE id = $1;
+WHERE id = $1
+AND deleted_at IS NULL;
 
 -- name: DeleteChirp :exec
 DELETE FROM chirps
 WHERE id = $1;
 
+-- name: GetChirpForUpdate :one
+SELECT *
+FROM chirps
+WHERE id = $1
+AND deleted_at IS NULL
+FOR UPDATE;
+
+-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: TombstoneChirp :execrows
+UPDATE chirps
+SET body = '', deleted_at = NOW()
+WHERE id = $1
+AND (
+	EXISTS (SELECT 1 FROM chirps replies WHERE replies.reply_to_id = chirps.id)
+	OR EXISTS (SELECT 1 FROM chirps quotes WHERE quotes.quote_of_id = chirps.id)
+);
+
+-- name: CountChirpReplies :many
+SELECT reply_to_id::uuid AS chirp_id, COUNT(*) AS reply_count
+FROM chirps
+WHERE reply_to_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+AND deleted_at IS NULL
+GROUP BY reply_to_id;
+
+-- name: ListChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+	SELECT parent.*, 1 AS depth
+	FROM chirps parent
+	WHERE parent.id = (SELECT c.reply_to_id FROM chirps c WHERE c.id = $1)
+	UNION ALL
+	SELECT parent.*, ancestors.depth + 1
+	FROM chirps parent
+	JOIN ancestors ON parent.id = ancestors.reply_to_id
+)
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, deleted_at, rechirp_of_id, quote_of_id
+FROM ancestors
+ORDER BY depth DESC;
+
+-- name: ListChirpDescendants :many
+WITH RECURSIVE descendants AS (
+	SELECT reply.*
+	FROM chirps reply
+	WHERE reply.reply_to_id = sqlc.arg('chirp_id')::uuid
+	UNION ALL
+	SELECT reply.*
+	FROM chirps reply
+	JOIN descendants ON reply.reply_to_id = descendants.id
+)
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, deleted_at, rechirp_of_id, quote_of_id
+FROM descendants
+WHERE (
+	sqlc.narg('cursor_created_at')::timestamp IS NULL
+	OR (created_at, id) > (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpsByIDs :many
+SELECT *
+FROM chirps
+WHERE id = ANY(sqlc.arg('ids')::uuid[]);
+
+-- name: GetRechirp :one
+SELECT *
+FROM chirps
+WHERE user_id = $1
+AND rechirp_of_id = $2;
+
+-- name: DeleteRechirp :exec
+DELETE FROM chirps
+WHERE user_id = $1
+AND rechirp_of_id = $2;
+
+-- name: DeleteRechirps :exec
+DELETE FROM chirps
+WHERE rechirp_of_id = $1;
+
+-- name: CountChirpRechirps :many
+SELECT rechirp_of_id::uuid AS chirp_id, COUNT(*) AS rechirp_count
+FROM chirps
+WHERE rechirp_of_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+GROUP BY rechirp_of_id;
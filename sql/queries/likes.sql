@@ -0,0 +1,33 @@
+-- name: LikeChirp :exec
+INSERT INTO likes (user_id, chirp_id, created_at)
+VALUES (
+	$1, $2, NOW()
+)
+ON CONFLICT (user_id, chirp_id) DO NOTHING;
+
+-- name: UnlikeChirp :exec
+DELETE FROM likes
+WHERE user_id = $1
+AND chirp_id = $2;
+
+-- name: CountChirpLikes :many
+SELECT chirp_id, COUNT(*) AS like_count,
+	COALESCE(BOOL_OR(user_id = sqlc.narg('viewer_id')::uuid), FALSE)::boolean AS liked_by_viewer
+FROM likes
+WHERE chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+GROUP BY chirp_id;
+
+-- name: ListUserLikes :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id,
+	chirps.reply_to_id, chirps.deleted_at, chirps.rechirp_of_id, chirps.quote_of_id,
+	likes.created_at AS liked_at
+FROM likes
+JOIN chirps ON chirps.id = likes.chirp_id
+WHERE likes.user_id = sqlc.arg('user_id')
+AND chirps.deleted_at IS NULL
+AND (
+	sqlc.narg('cursor_created_at')::timestamp IS NULL
+	OR (likes.created_at, likes.chirp_id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY likes.created_at DESC, likes.chirp_id DESC
+LIMIT sqlc.arg('limit');
@@ -0,0 +1,19 @@
+-- name: CreateMagicLinkToken :exec
+INSERT INTO magic_link_tokens (token_hash, created_at, expires_at, used_at, user_id)
+VALUES (
+	$1, NOW(), NOW() + INTERVAL '15 minutes', NULL, $2
+);
+
+-- name: UseMagicLinkToken :one
+UPDATE magic_link_tokens
+SET used_at = NOW()
+WHERE token_hash = $1
+AND used_at IS NULL
+AND expires_at > NOW()
+RETURNING user_id;
+
+-- name: InvalidateMagicLinkTokens :exec
+UPDATE magic_link_tokens
+SET used_at = NOW()
+WHERE user_id = $1
+AND used_at IS NULL;
@@ -0,0 +1,13 @@
+-- name: CreateOAuthAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (code_hash, created_at, expires_at, used_at, client_id, user_id, redirect_uri, scopes, code_challenge)
+VALUES (
+	$1, NOW(), NOW() + INTERVAL '10 minutes', NULL, $2, $3, $4, $5, $6
+);
+
+-- name: UseOAuthAuthorizationCode :one
+UPDATE oauth_authorization_codes
+SET used_at = NOW()
+WHERE code_hash = $1
+AND used_at IS NULL
+AND expires_at > NOW()
+RETURNING *;
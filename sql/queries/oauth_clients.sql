@@ -0,0 +1,27 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, created_at, name, secret_hash, redirect_uris, user_id)
+VALUES (
+	gen_random_uuid(), NOW(), $1, $2, $3, $4
+)
+RETURNING *;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = $1
+AND user_id = $2;
+
+-- name: GetOAuthClient :one
+SELECT *
+FROM oauth_clients
+WHERE id = $1;
+
+-- name: ListOAuthClients :many
+SELECT *
+FROM oauth_clients
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: SetOAuthClientCanIntrospect :execrows
+UPDATE oauth_clients
+SET can_introspect = $2
+WHERE id = $1;
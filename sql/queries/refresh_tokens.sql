@@ -1,18 +1,53 @@
 -- name: CreateRefreshToken :exec
-INSERT INTO refresh_tokens (token, created_at, updated_at, expires_at, revoked_at, user_id)
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, expires_at, revoked_at, user_id, family_id, user_agent, ip_address, last_used_at, client_id, scopes)
 VALUES(
-	$1, NOW(), NOW(), NOW() + INTERVAL '7 days', null, $2
+	$1, NOW(), NOW(), NOW() + INTERVAL '7 days', null, $2, $3, $4, $5, NOW(), $6, $7
 	);
 
+-- name: GetRefreshToken :one
+SELECT *
+FROM refresh_tokens
+WHERE token_hash = $1;
+
 -- name: GetUserFromRefreshToken :one
-SELECT user_id
+SELECT refresh_tokens.user_id, refresh_tokens.created_at, refresh_tokens.expires_at,
+	refresh_tokens.client_id, refresh_tokens.scopes, users.role
 FROM refresh_tokens
-WHERE token = $1
+JOIN users ON users.id = refresh_tokens.user_id
+WHERE token_hash = $1
 AND revoked_at IS NULL
 AND expires_at > NOW()
 LIMIT 1;
 
+-- name: RotateRefreshToken :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW(), replaced_by = $2
+WHERE token_hash = $1
+AND revoked_at IS NULL;
+
 -- name: RevokeToken :exec
 UPDATE refresh_tokens
 SET revoked_at = NOW(), updated_at = NOW()
-WHERE token = $1;
+WHERE token_hash = $1;
+
+-- name: RevokeTokenFamily :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1
+AND user_id = $2
+AND revoked_at IS NULL;
+
+-- name: RevokeAllUserTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1
+AND revoked_at IS NULL;
+
+-- name: ListActiveSessions :many
+SELECT family_id, user_agent, ip_address, last_used_at, expires_at,
+	(SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = refresh_tokens.family_id)::timestamp AS started_at
+FROM refresh_tokens
+WHERE user_id = $1
+AND revoked_at IS NULL
+AND expires_at > NOW()
+ORDER BY last_used_at DESC;
@@ -0,0 +1,26 @@
+-- name: SetUserTokenCutoff :exec
+INSERT INTO user_token_cutoffs (user_id, not_before)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE
+SET not_before = EXCLUDED.not_before;
+
+-- name: GetUserTokenCutoff :one
+SELECT not_before
+FROM user_token_cutoffs
+WHERE user_id = $1;
+
+-- name: RevokeAccessToken :exec
+INSERT INTO revoked_access_tokens (jti, created_at, expires_at, user_id)
+VALUES ($1, NOW(), $2, $3)
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: IsAccessTokenRevoked :one
+SELECT EXISTS (
+	SELECT 1
+	FROM revoked_access_tokens
+	WHERE jti = $1
+);
+
+-- name: DeleteExpiredRevokedAccessTokens :exec
+DELETE FROM revoked_access_tokens
+WHERE expires_at < NOW();
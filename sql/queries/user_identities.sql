@@ -0,0 +1,11 @@
+-- name: CreateUserIdentity :exec
+INSERT INTO user_identities (issuer, subject, created_at, user_id)
+VALUES (
+	$1, $2, NOW(), $3
+);
+
+-- name: GetUserIdentity :one
+SELECT *
+FROM user_identities
+WHERE issuer = $1
+AND subject = $2;
@@ -3,7 +3,7 @@ INSERT INTO users (id, created_at,  updated_at, email, hashed_password)
 VALUES (
 	gen_random_uuid(), NOW(), NOW(), $1, $2
 )
-RETURNING id, created_at, updated_at, email;
+RETURNING id, created_at, updated_at, email, is_chirpy_red, role;
 
 -- name: DeleteUsers :exec
 DELETE FROM users;
@@ -13,8 +13,44 @@ SELECT *
 FROM users
 WHERE email = $1;
 
--- name: UpdateUserByID :one
+-- name: GetUserByID :one
+SELECT *
+FROM users
+WHERE id = $1;
+
+-- name: UpgradeUserToChirpyRed :execrows
+UPDATE users
+SET is_chirpy_red = TRUE, updated_at = NOW()
+WHERE id = $1;
+
+-- name: UpdateUserPassword :one
 UPDATE users
-SET email = $2, hashed_password = $3
+SET hashed_password = $2, updated_at = NOW()
 WHERE id = $1
-RETURNING id, created_at, updated_at, email;
+RETURNING *;
+
+-- name: VerifyUserEmail :exec
+UPDATE users
+SET email = $2, email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1;
+
+-- name: SetUserTOTPSecret :exec
+UPDATE users
+SET totp_secret = $2, totp_enabled_at = NULL, totp_last_step = NULL, updated_at = NOW()
+WHERE id = $1;
+
+-- name: EnableUserTOTP :exec
+UPDATE users
+SET totp_enabled_at = NOW(), totp_last_step = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: UseUserTOTPStep :execrows
+UPDATE users
+SET totp_last_step = sqlc.arg('step')
+WHERE id = sqlc.arg('id')
+AND (totp_last_step IS NULL OR totp_last_step < sqlc.arg('step'));
+
+-- name: SetUserRole :execrows
+UPDATE users
+SET role = $2, updated_at = NOW()
+WHERE id = $1;
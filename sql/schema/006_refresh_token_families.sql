@@ -0,0 +1,12 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+ADD family_id UUID NOT NULL DEFAULT gen_random_uuid(),
+ADD replaced_by TEXT;
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+-- +goose Down
+DROP INDEX refresh_tokens_family_id_idx;
+ALTER TABLE refresh_tokens
+DROP COLUMN replaced_by,
+DROP COLUMN family_id;
@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE refresh_tokens RENAME COLUMN token TO token_hash;
+
+-- Existing sessions keep working: clients still present the raw token,
+-- which now hashes to the stored value.
+UPDATE refresh_tokens
+SET token_hash = encode(sha256(convert_to(token_hash, 'UTF8')), 'hex'),
+	replaced_by = encode(sha256(convert_to(replaced_by, 'UTF8')), 'hex');
+
+-- +goose Down
+-- The raw tokens cannot be recovered from their hashes, so every
+-- outstanding refresh token is revoked.
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE revoked_at IS NULL;
+
+ALTER TABLE refresh_tokens RENAME COLUMN token_hash TO token;
@@ -0,0 +1,19 @@
+-- +goose Up
+ALTER TABLE users
+ADD email_verified_at TIMESTAMP;
+
+-- Accounts created before verification existed keep their current address
+UPDATE users SET email_verified_at = NOW();
+
+CREATE TABLE email_verification_tokens (
+	token_hash TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	email TEXT NOT NULL,
+	user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE email_verification_tokens;
+ALTER TABLE users DROP COLUMN email_verified_at;
@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE users
+ADD totp_secret TEXT,
+ADD totp_enabled_at TIMESTAMP,
+ADD totp_last_step BIGINT;
+
+CREATE TABLE recovery_codes (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	code_hash TEXT NOT NULL,
+	user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	UNIQUE (user_id, code_hash)
+);
+
+-- +goose Down
+DROP TABLE recovery_codes;
+ALTER TABLE users
+DROP COLUMN totp_last_step,
+DROP COLUMN totp_enabled_at,
+DROP COLUMN totp_secret;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- Access tokens issued to a user before not_before are rejected
+CREATE TABLE user_token_cutoffs (
+	user_id UUID PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+	not_before TIMESTAMP NOT NULL
+);
+
+-- Individually revoked access tokens, kept until they would have expired
+CREATE TABLE revoked_access_tokens (
+	jti TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE revoked_access_tokens;
+DROP TABLE user_token_cutoffs;
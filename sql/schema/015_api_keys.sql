@@ -0,0 +1,19 @@
+-- +goose Up
+-- Personal API keys. scopes is a space-separated list, as in access tokens.
+CREATE TABLE api_keys (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP,
+	revoked_at TIMESTAMP,
+	last_used_at TIMESTAMP,
+	name TEXT NOT NULL,
+	key_prefix TEXT NOT NULL,
+	key_hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL,
+	user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX api_keys_user_id_idx ON api_keys (user_id);
+
+-- +goose Down
+DROP TABLE api_keys;
@@ -0,0 +1,38 @@
+-- +goose Up
+-- Third-party applications registered by users. Public clients (e.g. mobile
+-- and single page apps) have no secret and rely on PKCE alone.
+-- redirect_uris is a space-separated list of exact redirect URIs.
+CREATE TABLE oauth_clients (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	name TEXT NOT NULL,
+	secret_hash TEXT,
+	redirect_uris TEXT NOT NULL,
+	user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX oauth_clients_user_id_idx ON oauth_clients (user_id);
+
+CREATE TABLE oauth_authorization_codes (
+	code_hash TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	client_id UUID NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+	user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	redirect_uri TEXT NOT NULL,
+	scopes TEXT NOT NULL,
+	code_challenge TEXT NOT NULL
+);
+
+-- Refresh tokens issued to OAuth clients are limited to the granted scopes
+ALTER TABLE refresh_tokens
+ADD client_id UUID REFERENCES oauth_clients (id) ON DELETE CASCADE,
+ADD scopes TEXT;
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN scopes,
+DROP COLUMN client_id;
+DROP TABLE oauth_authorization_codes;
+DROP TABLE oauth_clients;
@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE magic_link_tokens (
+	token_hash TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX magic_link_tokens_user_id_idx ON magic_link_tokens (user_id);
+
+-- +goose Down
+DROP TABLE magic_link_tokens;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- Earlier bodies of edited chirps. created_at is when the body was posted
+-- and replaced_at when an edit superseded it.
+CREATE TABLE chirp_revisions (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	replaced_at TIMESTAMP NOT NULL,
+	body TEXT NOT NULL,
+	chirp_id UUID NOT NULL REFERENCES chirps (id) ON DELETE CASCADE
+);
+
+CREATE INDEX chirp_revisions_chirp_id_replaced_at_idx ON chirp_revisions (chirp_id, replaced_at);
+
+-- +goose Down
+DROP TABLE chirp_revisions;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- Deleting a chirp that has replies leaves a tombstone (an empty body and
+-- deleted_at) so the rest of the conversation stays connected. Replies are
+-- only detached when their parent is removed outright, e.g. with its author.
+ALTER TABLE chirps
+ADD reply_to_id UUID REFERENCES chirps (id) ON DELETE SET NULL,
+ADD deleted_at TIMESTAMP;
+
+CREATE INDEX chirps_reply_to_id_created_at_id_idx ON chirps (reply_to_id, created_at, id);
+
+-- +goose Down
+DROP INDEX chirps_reply_to_id_created_at_id_idx;
+ALTER TABLE chirps
+DROP COLUMN deleted_at,
+DROP COLUMN reply_to_id;
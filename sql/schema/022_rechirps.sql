@@ -0,0 +1,23 @@
+-- +goose Up
+-- A rechirp is a bodiless pointer to the chirp being shared, and disappears
+-- with it. Quotes keep their own body; a quoted chirp is tombstoned rather
+-- than removed so the quote can still show that it was deleted.
+ALTER TABLE chirps
+ADD rechirp_of_id UUID REFERENCES chirps (id) ON DELETE CASCADE,
+ADD quote_of_id UUID REFERENCES chirps (id) ON DELETE SET NULL,
+ADD CONSTRAINT chirps_rechirp_has_no_body CHECK (
+	rechirp_of_id IS NULL
+	OR (body = '' AND reply_to_id IS NULL AND quote_of_id IS NULL)
+);
+
+CREATE UNIQUE INDEX chirps_rechirp_of_id_user_id_idx ON chirps (rechirp_of_id, user_id)
+WHERE rechirp_of_id IS NOT NULL;
+CREATE INDEX chirps_quote_of_id_idx ON chirps (quote_of_id);
+
+-- +goose Down
+DROP INDEX chirps_quote_of_id_idx;
+DROP INDEX chirps_rechirp_of_id_user_id_idx;
+ALTER TABLE chirps
+DROP CONSTRAINT chirps_rechirp_has_no_body,
+DROP COLUMN quote_of_id,
+DROP COLUMN rechirp_of_id;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- Only resource servers an admin has trusted may introspect tokens
+ALTER TABLE oauth_clients
+ADD can_introspect BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE oauth_clients
+DROP COLUMN can_introspect;
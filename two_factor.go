@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+)
+
+const (
+	mfaTokenLifetime  = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+type mfaRequiredResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+type totpEnrollmentResponse struct {
+	Secret        string   `json:"secret"`
+	OTPAuthURI    string   `json:"otpauth_uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (cfg *apiConfig) handlerEnrollTOTP(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	userID := claims.UserID
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "User does not exist",
+		})
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		respondWithJson(w, http.StatusConflict, errorResponse{
+			Error: "Two-factor authentication is already enabled",
+		})
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		log.Printf("Failed to generate totp secret: %v", err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	recoveryCodes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		log.Printf("Failed to generate recovery codes: %v", err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	tx, err := cfg.sqlDB.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Failed to begin transaction: %v", err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	err = qtx.SetUserTOTPSecret(r.Context(), database.SetUserTOTPSecretParams{
+		ID:         user.ID,
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+	})
+	if err == nil {
+		err = qtx.DeleteRecoveryCodes(r.Context(), user.ID)
+	}
+	for _, code := range recoveryCodes {
+		if err != nil {
+			break
+		}
+		err = qtx.CreateRecoveryCode(r.Context(), database.CreateRecoveryCodeParams{
+			CodeHash: auth.HashRecoveryCode(code),
+			UserID:   user.ID,
+		})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Failed to store totp enrollment for user %s: %v", user.ID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, totpEnrollmentResponse{
+		Secret:        secret,
+		OTPAuthURI:    auth.TOTPURI("Chirpy", user.Email, secret),
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+func (cfg *apiConfig) handlerVerifyTOTP(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	type requestParams struct {
+		Code string `json:"code"`
+	}
+
+	userID := claims.UserID
+
+	decoder := json.NewDecoder(r.Body)
+	params := requestParams{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "Couldn't decode parameters",
+		})
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "User does not exist",
+		})
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		respondWithJson(w, http.StatusConflict, errorResponse{
+			Error: "Two-factor authentication is already enabled",
+		})
+		return
+	}
+	if !user.TotpSecret.Valid {
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "Two-factor authentication has not been enrolled",
+		})
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(user.TotpSecret.String, params.Code, time.Now())
+	if !ok {
+		respondWithJson(w, http.StatusUnauthorized, errorResponse{
+			Error: "Invalid code",
+		})
+		return
+	}
+
+	err = cfg.db.EnableUserTOTP(r.Context(), database.EnableUserTOTPParams{
+		ID:           user.ID,
+		TotpLastStep: sql.NullInt64{Int64: step, Valid: true},
+	})
+	if err != nil {
+		log.Printf("Failed to enable totp for user %s: %v", user.ID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	log.Printf("Two-factor authentication enabled for user %s", user.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleLoginTOTP(w http.ResponseWriter, r *http.Request) {
+	type requestParams struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+		UseCookies   bool   `json:"use_cookies"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := requestParams{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "Couldn't decode parameters",
+		})
+		return
+	}
+
+	userID, err := auth.ValidateMFAToken(params.MFAToken, cfg.jwtKeys)
+	if err != nil {
+		respondWithJson(w, http.StatusUnauthorized, errorResponse{
+			Error: "Invalid or expired mfa token",
+		})
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil || !user.TotpEnabledAt.Valid {
+		respondWithJson(w, http.StatusUnauthorized, errorResponse{
+			Error: "Invalid or expired mfa token",
+		})
+		return
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords
+	accountKey := accountThrottleKey(user.Email)
+	ip := cfg.clientIP(r)
+	if wait := max(cfg.accountThrottle.retryAfter(accountKey), cfg.ipThrottle.retryAfter(ip)); wait > 0 {
+		cfg.respondWithCredentialError(w, &loginThrottledError{retryAfter: wait})
+		return
+	}
+
+	if !cfg.verifySecondFactor(r.Context(), user, params.Code, params.RecoveryCode) {
+		cfg.recordLoginFailure(accountKey, ip)
+		respondWithJson(w, http.StatusUnauthorized, errorResponse{
+			Error: "Invalid code",
+		})
+		return
+	}
+	cfg.accountThrottle.reset(accountKey)
+
+	cfg.respondWithLogin(w, r, user, params.UseCookies)
+}
+
+// verifySecondFactor checks and consumes either a TOTP code or a recovery code
+// for a user with two-factor authentication enabled.
+func (cfg *apiConfig) verifySecondFactor(ctx context.Context, user database.User, code, recoveryCode string) bool {
+	switch {
+	case code != "":
+		step, ok := auth.ValidateTOTP(user.TotpSecret.String, code, time.Now())
+		if !ok {
+			return false
+		}
+		// Each code may only be used once
+		rows, err := cfg.db.UseUserTOTPStep(ctx, database.UseUserTOTPStepParams{
+			Step: sql.NullInt64{Int64: step, Valid: true},
+			ID:   user.ID,
+		})
+		return err == nil && rows == 1
+	case recoveryCode != "":
+		rows, err := cfg.db.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			UserID:   user.ID,
+			CodeHash: auth.HashRecoveryCode(recoveryCode),
+		})
+		if err != nil || rows != 1 {
+			return false
+		}
+		log.Printf("Recovery code used by user %s", user.ID)
+		return true
+	default:
+		return false
+	}
+}
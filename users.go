@@ -2,7 +2,6 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
 	"time"
@@ -18,10 +17,14 @@ type createUserJson struct {
 }
 
 type userJson struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Email     string    `json:"email"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	EmailVerified bool      `json:"email_verified"`
+	PendingEmail  string    `json:"pending_email,omitempty"`
+	Role          string    `json:"role"`
 }
 
 func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request) {
@@ -37,7 +40,11 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	password, err := auth.HashPassword(params.Password)
+	if !cfg.checkPasswordPolicy(w, r, params.Password, params.Email) {
+		return
+	}
+
+	password, err := cfg.passwordHasher.Hash(params.Password)
 	if err != nil {
 		respondWithJson(w, http.StatusInternalServerError, errorResponse{
 			"Password could not be hashed",
@@ -48,43 +55,43 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 		Email:          params.Email,
 		HashedPassword: password,
 	})
+	if isUniqueViolation(err) {
+		respondWithJson(w, http.StatusConflict, errorResponse{
+			Error: "Email already in use",
+		})
+		return
+	}
 	if err != nil {
 		log.Printf("Error creating user in database: %s", err)
 		respondWithJson(w, http.StatusInternalServerError, errorResponse{
 			Error: "Couldn't create user",
 		})
+		return
+	}
+
+	err = cfg.sendEmailVerification(r.Context(), user.ID, user.Email)
+	if err != nil {
+		log.Printf("Failed to send verification email: %v", err)
 	}
 
 	respondWithJson(w, http.StatusCreated, userJson{
-		ID:        user.ID,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-		Email:     user.Email,
+		ID:          user.ID,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+		Email:       user.Email,
+		IsChirpyRed: user.IsChirpyRed,
+		Role:        user.Role,
 	})
 	log.Printf("User Created: %v", user)
 
 }
 
-func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithJson(w, http.StatusUnauthorized, errorResponse{
-			Error: fmt.Sprintf("Could not retrieve bearer token: %v", err),
-		})
-		return
-	}
-
-	user_id, err := auth.ValidateJWT(token, cfg.secret)
-	if err != nil {
-		respondWithJson(w, http.StatusUnauthorized, errorResponse{
-			Error: fmt.Sprintf("User could not be authenticated: %v", err),
-		})
-		return
-	}
+func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request, claims auth.AccessClaims) {
+	user_id := claims.UserID
 
 	decoder := json.NewDecoder(r.Body)
 	params := createUserJson{}
-	err = decoder.Decode(&params)
+	err := decoder.Decode(&params)
 	if err != nil {
 		log.Printf("Error decoding user parameters: %s", err)
 		respondWithJson(w, http.StatusInternalServerError, errorResponse{
@@ -93,31 +100,109 @@ func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(params.Password)
+	userInfo, err := cfg.db.GetUserByID(r.Context(), user_id)
 	if err != nil {
-		respondWithJson(w, http.StatusInternalServerError, errorResponse{
-			Error: "Something went wrong",
+		respondWithJson(w, http.StatusNotFound, errorResponse{
+			Error: "User does not exist",
 		})
 		return
 	}
 
-	userInfo, err := cfg.db.UpdateUserByID(r.Context(), database.UpdateUserByIDParams{
-		ID:             user_id,
-		Email:          params.Email,
-		HashedPassword: hashedPassword,
-	})
-	if err != nil {
-		respondWithJson(w, http.StatusInternalServerError, errorResponse{
-			Error: "Something went wrong",
+	emailChanged := params.Email != "" && params.Email != userInfo.Email
+	if emailChanged {
+		_, err = cfg.db.GetUserByEmail(r.Context(), params.Email)
+		if err == nil {
+			respondWithJson(w, http.StatusConflict, errorResponse{
+				Error: "Email already in use",
+			})
+			return
+		}
+	}
+
+	// Re-submitting the current password leaves existing tokens alone
+	if auth.CheckPasswordHash(params.Password, userInfo.HashedPassword) != nil {
+		email := userInfo.Email
+		if emailChanged {
+			email = params.Email
+		}
+		if !cfg.checkPasswordPolicy(w, r, params.Password, email) {
+			return
+		}
+
+		hashedPassword, err := cfg.passwordHasher.Hash(params.Password)
+		if err != nil {
+			respondWithJson(w, http.StatusInternalServerError, errorResponse{
+				Error: "Something went wrong",
+			})
+			return
+		}
+
+		tx, err := cfg.sqlDB.BeginTx(r.Context(), nil)
+		if err != nil {
+			log.Printf("Failed to begin transaction: %v", err)
+			respondWithJson(w, http.StatusInternalServerError, errorResponse{
+				Error: "Something went wrong",
+			})
+			return
+		}
+		defer tx.Rollback()
+		qtx := cfg.db.WithTx(tx)
+
+		userInfo, err = qtx.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+			ID:             user_id,
+			HashedPassword: hashedPassword,
 		})
-		return
+		// Sessions, API keys and access tokens issued before the password
+		// change stop working
+		if err == nil {
+			err = qtx.RevokeAllUserTokens(r.Context(), user_id)
+		}
+		if err == nil {
+			err = qtx.RevokeUserAPIKeys(r.Context(), user_id)
+		}
+		var notBefore time.Time
+		if err == nil {
+			notBefore, err = storeUserTokenCutoff(r.Context(), qtx, user_id)
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			log.Printf("Failed to change password for user %s: %v", user_id, err)
+			respondWithJson(w, http.StatusInternalServerError, errorResponse{
+				Error: "Something went wrong",
+			})
+			return
+		}
+		cfg.revocations.setCutoff(user_id, notBefore)
 	}
 
-	respondWithJson(w, http.StatusOK, userJson{
-		ID:        userInfo.ID,
-		CreatedAt: userInfo.CreatedAt,
-		UpdatedAt: userInfo.UpdatedAt,
-		Email:     userInfo.Email,
-	})
+	response := newUserJson(userInfo)
+	// A new address only replaces the current one once it has been confirmed
+	if emailChanged {
+		err = cfg.sendEmailVerification(r.Context(), userInfo.ID, params.Email)
+		if err != nil {
+			log.Printf("Failed to send verification email: %v", err)
+			respondWithJson(w, http.StatusInternalServerError, errorResponse{
+				Error: "Couldn't send verification email",
+			})
+			return
+		}
+		response.PendingEmail = params.Email
+	}
+
+	respondWithJson(w, http.StatusOK, response)
 	log.Printf("User: %s info updated", userInfo.ID)
 }
+
+func newUserJson(user database.User) userJson {
+	return userJson{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		IsChirpyRed:   user.IsChirpyRed,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		Role:          user.Role,
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestUpdateUserReturnsUpdatedRow(t *testing.T) {
+	cfg, mock := newMockConfig(t)
+	cfg.passwordHasher = testPasswordHasher
+	cfg.passwordPolicy = auth.PasswordPolicy{MinLength: 8}
+
+	created := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	before := database.User{
+		ID:             uuid.New(),
+		CreatedAt:      created,
+		UpdatedAt:      created,
+		Email:          "walt@example.com",
+		HashedPassword: "old-hash",
+	}
+	after := before
+	after.UpdatedAt = created.Add(time.Hour)
+	after.HashedPassword = "new-hash"
+
+	mock.ExpectQuery(queryName("GetUserByID")).WillReturnRows(mockUserRows(before))
+	mock.ExpectBegin()
+	mock.ExpectQuery(queryName("UpdateUserPassword")).
+		WithArgs(before.ID.String(), sqlmock.AnyArg()).
+		WillReturnRows(mockUserRows(after))
+	mock.ExpectExec(queryName("RevokeAllUserTokens")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(queryName("RevokeUserAPIKeys")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(queryName("SetUserTokenCutoff")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest(http.MethodPut, "/api/users", strings.NewReader(
+		`{"email":"walt@example.com","password":"a brand new password"}`,
+	))
+	rec := httptest.NewRecorder()
+	cfg.handlerUpdateUser(rec, req, auth.AccessClaims{UserID: before.ID})
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var got userJson
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.UpdatedAt.Equal(after.UpdatedAt) {
+		t.Errorf("updated_at = %v, want %v from the update", got.UpdatedAt, after.UpdatedAt)
+	}
+}
+
+func TestChangePasswordRevokesInOneTransaction(t *testing.T) {
+	tests := []struct {
+		name       string
+		commitErr  error
+		wantStatus int
+		wantCached bool
+	}{
+		{
+			name:       "Cutoff is cached after commit",
+			wantStatus: http.StatusOK,
+			wantCached: true,
+		},
+		{
+			name:       "Failed commit leaves the cache alone",
+			commitErr:  errors.New("connection lost"),
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, mock := newMockConfig(t)
+			cfg.passwordHasher = testPasswordHasher
+			cfg.passwordPolicy = auth.PasswordPolicy{MinLength: 8}
+			user := database.User{ID: uuid.New(), Email: "walt@example.com", HashedPassword: "old-hash"}
+
+			mock.ExpectQuery(queryName("GetUserByID")).WillReturnRows(mockUserRows(user))
+			mock.ExpectBegin()
+			mock.ExpectQuery(queryName("UpdateUserPassword")).WillReturnRows(mockUserRows(user))
+			// Refresh tokens could otherwise mint access tokens after the cutoff
+			mock.ExpectExec(queryName("RevokeAllUserTokens")).
+				WithArgs(user.ID.String()).
+				WillReturnResult(sqlmock.NewResult(0, 2))
+			mock.ExpectExec(queryName("RevokeUserAPIKeys")).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(queryName("SetUserTokenCutoff")).WillReturnResult(sqlmock.NewResult(0, 1))
+			if test.commitErr != nil {
+				mock.ExpectCommit().WillReturnError(test.commitErr)
+			} else {
+				mock.ExpectCommit()
+			}
+
+			req := httptest.NewRequest(http.MethodPut, "/api/users", strings.NewReader(
+				`{"email":"walt@example.com","password":"a brand new password"}`,
+			))
+			rec := httptest.NewRecorder()
+			cfg.handlerUpdateUser(rec, req, auth.AccessClaims{UserID: user.ID})
+
+			if rec.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, test.wantStatus, rec.Body)
+			}
+			if _, ok := cfg.revocations.cutoffs[user.ID]; ok != test.wantCached {
+				t.Errorf("cutoff cached = %v, want %v", ok, test.wantCached)
+			}
+		})
+	}
+}
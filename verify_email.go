@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/JakeBurrell/chirpy/internal/auth"
+	"github.com/JakeBurrell/chirpy/internal/database"
+	"github.com/JakeBurrell/chirpy/internal/mail"
+	"github.com/google/uuid"
+)
+
+// sendEmailVerification emails a confirmation link for address to the user.
+// The address is only attached to the account once the link is followed.
+func (cfg *apiConfig) sendEmailVerification(ctx context.Context, userID uuid.UUID, address string) error {
+	token, err := auth.MakeOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	err = cfg.db.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		Email:     address,
+		UserID:    userID,
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/api/verify-email?token=%s", cfg.baseURL, url.QueryEscape(token))
+	cfg.sendMailAsync(mail.Message{
+		To:      address,
+		Subject: "Confirm your Chirpy email address",
+		Body: fmt.Sprintf(
+			"Follow this link within 24 hours to confirm your email address:\n\n%s\n\n"+
+				"If you didn't sign up for Chirpy, you can ignore this email.\n",
+			link,
+		),
+	})
+	return nil
+}
+
+func (cfg *apiConfig) handlerVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "No token provided",
+		})
+		return
+	}
+
+	tx, err := cfg.sqlDB.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Failed to begin transaction: %v", err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	verification, err := qtx.UseEmailVerificationToken(r.Context(), auth.HashToken(token))
+	if err != nil {
+		respondWithJson(w, http.StatusBadRequest, errorResponse{
+			Error: "Invalid or expired token",
+		})
+		return
+	}
+
+	err = qtx.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{
+		ID:    verification.UserID,
+		Email: verification.Email,
+	})
+	if isUniqueViolation(err) {
+		respondWithJson(w, http.StatusConflict, errorResponse{
+			Error: "Email already in use",
+		})
+		return
+	}
+	if err == nil {
+		err = qtx.InvalidateEmailVerificationTokens(r.Context(), verification.UserID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Failed to verify email for user %s: %v", verification.UserID, err)
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), verification.UserID)
+	if err != nil {
+		respondWithJson(w, http.StatusInternalServerError, errorResponse{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	log.Printf("Email verified for user %s", user.ID)
+	respondWithJson(w, http.StatusOK, newUserJson(user))
+}